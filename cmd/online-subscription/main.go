@@ -2,44 +2,115 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
 	_ "online-subscription/docs"
 	"online-subscription/internal/app"
+	"online-subscription/internal/config"
 	"online-subscription/internal/logger"
+	"online-subscription/internal/tenant"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
 	"go.uber.org/zap"
 )
 
 // @title Online Subscriptions API service
-// @version 1.0
+// @version 1.1
 // @description Агреграция данных об онлайн-подписках пользователей
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT in the form "Bearer <token>". The subject is the user ID, the "admin" role grants access to all users' data
 func main() {
-	application := app.Start()
-	srv := application.Server
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Server crashed", zap.Error(err))
-		}
-	}()
+	if len(args) > 0 {
+		os.Exit(runCommand(cfg, args[0], args[1:]))
+	}
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	logger.Info("Shutdown signal received")
+	application, err := app.New(ctx, cfg)
+	if err != nil {
+		logger.Error("Failed to start", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+	go application.WatchConfig(ctx, os.Args[1:])
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	err = application.Run(ctx)
+	if err != nil {
+		logger.Error("Server stopped with an error", zap.Error(err))
+	}
+	if cerr := application.Close(); cerr != nil {
+		logger.Error("Failed to release resources", zap.Error(cerr))
+		err = errors.Join(err, cerr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	logger.Info("Server stopped gracefully")
+}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		logger.Error("Graceful shutdown failed", zap.Error(err))
-	} else {
-		logger.Info("Server stopped gracefully")
+func runCommand(cfg *config.Config, name string, args []string) int {
+	switch name {
+	case "config":
+		if len(args) != 1 || args[0] != "print" {
+			fmt.Fprintln(os.Stderr, "usage: config print")
+			return 1
+		}
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, "config print:", err)
+			return 1
+		}
+		return 0
+	case "check-spend":
+		ok, err := app.CheckSpend(context.Background(), cfg, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "check-spend:", err)
+			return 1
+		}
+		if !ok {
+			return 2
+		}
+		return 0
+	case "migrate":
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if err := app.Migrate(ctx, cfg, os.Stdout, args); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		return 0
+	case "create-api-key":
+		if len(args) != 2 && len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: create-api-key <name> <scope>[,<scope>...] [tenant]")
+			return 1
+		}
+		tenantID := tenant.Default
+		if len(args) == 3 {
+			tenantID = args[2]
+		}
+		if err := app.CreateAPIKey(context.Background(), cfg, os.Stdout, tenantID, args[0], strings.Split(args[1], ",")); err != nil {
+			fmt.Fprintln(os.Stderr, "create-api-key:", err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		return 1
 	}
 }
@@ -1,54 +1,452 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"online-subscription/internal/auth"
 	"online-subscription/internal/config"
 	"online-subscription/internal/handler"
 	"online-subscription/internal/logger"
+	"online-subscription/internal/metrics"
+	"online-subscription/internal/notify"
+	"online-subscription/internal/ratelimit"
+	"online-subscription/internal/rbac"
 	"online-subscription/internal/repository"
 	"online-subscription/internal/repository/postgres"
+	"online-subscription/internal/scheduler"
+	"online-subscription/internal/tracing"
 	"online-subscription/internal/usecase"
-	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
+// App is the whole service: the HTTP API, the background jobs and the
+// resources they share. New builds it, Run serves until its context is done
+// and Close releases what is left.
 type App struct {
-	Server *http.Server
+	Server    *http.Server
+	Scheduler *scheduler.Scheduler
+	Health    *Health
+
+	log             *zap.Logger
+	registry        *prometheus.Registry
+	listener        net.Listener
+	metricsServer   *http.Server
+	metricsListener net.Listener
+	db              *sqlx.DB
+	ownDB           bool
+	jobsDB          *sqlx.DB // sees every tenant; db unless DB_JOBS_USER is set
+	changes         *postgres.ChangeListener
+	shutdownTracing func(context.Context) error
+
+	// cfg is the configuration the app was started with and never changes.
+	// applied is cfg with the settings Reload has applied since, and Reload
+	// swaps the settings below while requests are served.
+	cfg        *config.Config
+	reloadMu   sync.Mutex
+	applied    *config.Config // guarded by reloadMu
+	limitStore ratelimit.Store
+	limits     atomic.Pointer[RateLimiter]
+	timeouts   atomic.Pointer[RequestTimeouts]
+}
+
+// Option replaces a dependency that New otherwise builds from the
+// configuration, so that tests can boot the service against their own.
+type Option func(*options)
+
+type options struct {
+	db     *sqlx.DB
+	subs   repository.SubscriptionRepository
+	clock  func() time.Time
+	logger *zap.Logger
+}
+
+// WithDB uses an open connection pool instead of connecting to cfg.DB. The
+// caller keeps ownership: Close leaves it open.
+func WithDB(db *sqlx.DB) Option {
+	return func(o *options) { o.db = db }
+}
+
+// WithSubscriptionRepo replaces the PostgreSQL subscription repository.
+func WithSubscriptionRepo(r repository.SubscriptionRepository) Option {
+	return func(o *options) { o.subs = r }
+}
+
+// WithClock sets the time the use cases and jobs consider current.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.clock = now }
+}
+
+// WithLogger replaces the logger configured by cfg.Log. The global logger
+// is left as it is, so several apps in one process keep their logs apart.
+func WithLogger(l *zap.Logger) Option {
+	return func(o *options) { o.logger = l }
 }
 
-func Start() *App {
-	cfg := config.LoadConfig(".env")
+// New connects to the database, migrates it and wires the service up. It
+// also opens the listeners, so that Addr and MetricsAddr are known before
+// Run even when the ports are 0. On error everything acquired so far is released.
+func New(ctx context.Context, cfg *config.Config, opts ...Option) (_ *App, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	log := o.logger
+	if log == nil {
+		if err := initLogger(cfg); err != nil {
+			return nil, err
+		}
+		log = logger.Get()
+	}
+
+	a := &App{cfg: cfg, applied: cfg, db: o.db, log: log, registry: metrics.NewRegistry()}
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+
+	if a.db == nil {
+		a.db, err = repository.ConnectWithRetry(cfg.DSN(), a.log, 10, 2*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("connect to database: %w", err)
+		}
+		a.ownDB = true
+	}
+	db := a.db
 
-	if err := logger.Init(cfg.LogLevel); err != nil {
-		panic(err)
+	a.jobsDB = db
+	if a.ownDB && cfg.DB.JobsUser != "" {
+		a.jobsDB, err = repository.ConnectWithRetry(cfg.JobsDSN(), a.log, 10, 2*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("connect to database as jobs user: %w", err)
+		}
 	}
-	defer logger.Sync()
 
-	db, err := repository.ConnectWithRetry(cfg.DSN(), logger.Get(), 10, 2*time.Second)
+	if cfg.DB.AutoMigrate {
+		if err := repository.RunMigrations(db, cfg.DB.Migrations); err != nil {
+			return nil, fmt.Errorf("run migrations: %w", err)
+		}
+	} else {
+		a.log.Info("Automatic migration is disabled, readiness waits for the schema")
+	}
+	migration, err := repository.LatestMigration(cfg.DB.Migrations)
 	if err != nil {
-		logger.Error("Failed to connect to DB after retries", zap.Error(err))
-		os.Exit(1)
+		return nil, fmt.Errorf("read migrations: %w", err)
 	}
 
-	if err := repository.RunMigrations(db, "file:///app/migrations"); err != nil {
-		logger.Error("Failed to run migrations", zap.Error(err))
-		os.Exit(1)
+	a.shutdownTracing, err = tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configure tracing: %w", err)
 	}
 
-	repo := postgres.NewSubscriptionRepo(db)
-	uc := usecase.NewSubscriptionUseCase(repo)
-	h := handler.NewSubscriptionHandler(uc)
+	if err := metrics.RegisterDB(a.registry, db.DB, cfg.DB.Name); err != nil {
+		a.log.Error("Failed to register DB metrics", zap.Error(err))
+	}
+	if err := metrics.RegisterBusiness(a.registry, postgres.NewStatsRepo(a.jobsDB), a.log); err != nil {
+		a.log.Error("Failed to register business metrics", zap.Error(err))
+	}
 
-	router := NewRouter(h)
+	policy := rbac.DefaultPolicy()
+	if cfg.Auth.PolicyFile != "" {
+		policy, err = rbac.LoadPolicy(cfg.Auth.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load access policy: %w", err)
+		}
+	}
+	authz := rbac.NewAuthorizer(policy, postgres.NewAuditRepo(db, cfg.DB.TenantRLS))
 
-	srv := &http.Server{
-		Addr:    ":" + cfg.AppPort,
-		Handler: router,
+	repo := o.subs
+	if repo == nil {
+		repo = postgres.NewSubscriptionRepo(db, cfg.DB.TenantRLS)
+	}
+	uc := usecase.NewSubscriptionUseCase(repo, postgres.NewSpendRepo(db, cfg.DB.TenantRLS), authz)
+	budgets := usecase.NewBudgetUseCase(postgres.NewBudgetRepo(db, cfg.DB.TenantRLS), uc, authz)
+	maintenance := newMaintenance(a.jobsDB)
+	if o.clock != nil {
+		uc.SetClock(o.clock)
+		budgets.SetClock(o.clock)
+		maintenance.SetClock(o.clock)
+	}
+	// An injected database may not be reachable through the configured
+	// DSN, so change streams fall back to polling then.
+	if a.ownDB {
+		a.changes = postgres.NewChangeListener(cfg.DSN(), a.log)
+		uc.SetChangeNotifier(a.changes)
+	}
+	h := handler.NewSubscriptionHandler(uc, budgets)
+	bh := handler.NewBudgetHandler(budgets)
+
+	keys := usecase.NewAPIKeyUseCase(postgres.NewAPIKeyRepo(db, cfg.DB.TenantRLS), authz)
+	kh := handler.NewAPIKeyHandler(keys)
+	sh := handler.NewSettingsHandler(usecase.NewSettingsUseCase(authz))
+
+	var authn *Authenticator
+	if cfg.Auth.Enabled {
+		authn = &Authenticator{APIKeys: keys}
+
+		v, err := auth.NewJWTVerifier(auth.JWTConfig{
+			HS256Secret:    cfg.Auth.HS256Secret,
+			RS256PublicKey: cfg.Auth.RS256PublicKeyFile,
+			JWKSFile:       cfg.Auth.JWKSFile,
+			Issuer:         cfg.Auth.Issuer,
+			Audience:       cfg.Auth.Audience,
+		})
+		switch {
+		case errors.Is(err, auth.ErrNoKeys):
+			a.log.Info("No JWT keys configured, only API keys are accepted")
+		case err != nil:
+			return nil, fmt.Errorf("configure authentication: %w", err)
+		default:
+			authn.JWT = v
+		}
+	} else {
+		a.log.Info("Authentication is disabled, the API is open to everyone")
+	}
+
+	a.limitStore, err = newRateLimitStore(cfg, db)
+	if err != nil {
+		return nil, fmt.Errorf("configure rate limits: %w", err)
+	}
+	limits, err := ParseRateLimits(a.limitStore, cfg.RateLimit.Default, cfg.RateLimit.Routes, cfg.RateLimit.AuthFailures)
+	if err != nil {
+		return nil, fmt.Errorf("configure rate limits: %w", err)
+	}
+	a.limits.Store(limits)
+
+	timeouts, err := ParseRequestTimeouts(cfg.Server.RequestTimeout, cfg.Server.RequestTimeoutRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("configure request timeouts: %w", err)
+	}
+	a.timeouts.Store(timeouts)
+
+	a.Scheduler = scheduler.New(postgres.NewAdvisoryLocker(db), a.log)
+	if cfg.Jobs.Enabled {
+		if err := registerJobs(a.Scheduler, cfg, maintenance); err != nil {
+			return nil, fmt.Errorf("register jobs: %w", err)
+		}
+	}
+
+	a.Health = NewHealth(db, a.Scheduler, migration)
+	router := NewRouter(h, bh, kh, sh, a.Health, middlewares(authn, &a.limits, &a.timeouts)...)
+
+	a.Server, err = newServer(cfg.Server, router)
+	if err != nil {
+		return nil, fmt.Errorf("configure server: %w", err)
+	}
+	// Requests log through the logger of this app.
+	a.Server.BaseContext = func(net.Listener) context.Context {
+		return logger.WithLogger(context.Background(), a.log)
+	}
+	a.Server.RegisterOnShutdown(h.CloseStreams)
+	a.listener, err = net.Listen("tcp", a.Server.Addr)
+	if err != nil {
+		return nil, err
 	}
-	logger.Info("Starting server", zap.String("port", cfg.AppPort))
 
-	return &App{Server: srv}
+	a.metricsServer = newMetricsServer(cfg.Server, a.registry)
+	a.metricsListener, err = net.Listen("tcp", a.metricsServer.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Addr is the address the API listens on.
+func (a *App) Addr() net.Addr {
+	return a.listener.Addr()
+}
+
+// MetricsAddr is the address /metrics is served on.
+func (a *App) MetricsAddr() net.Addr {
+	return a.metricsListener.Addr()
+}
+
+// Run starts the background jobs and serves the API until ctx is done, then
+// shuts down in dependency order. Readiness fails first so that the
+// orchestrator routes traffic away during the drain delay. Then the jobs
+// stop and in-flight requests finish, both bounded by the shutdown timeout.
+// Serving errors stop the jobs and are returned as they are.
+func (a *App) Run(ctx context.Context) error {
+	a.Scheduler.Start()
+	if a.changes != nil {
+		go a.changes.Run(logger.WithLogger(ctx, a.log))
+	}
+	a.log.Info("Starting server",
+		zap.String("addr", a.Addr().String()),
+		zap.String("metrics_addr", a.MetricsAddr().String()),
+		zap.Bool("tls", a.Server.TLSConfig != nil),
+	)
+
+	// Metrics are secondary: failing to serve them is logged rather than
+	// taking the API down.
+	go func() {
+		if err := a.metricsServer.Serve(a.metricsListener); !errors.Is(err, http.ErrServerClosed) {
+			a.log.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		if a.Server.TLSConfig != nil {
+			served <- a.Server.ServeTLS(a.listener, "", "")
+		} else {
+			served <- a.Server.Serve(a.listener)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return errors.Join(err, a.Scheduler.Stop(context.Background()), a.metricsServer.Close())
+	case <-ctx.Done():
+	}
+
+	srv := a.cfg.Server
+	a.Health.Drain()
+	a.log.Info("Shutdown requested, draining", zap.Duration("delay", srv.ShutdownDrainDelay))
+	time.Sleep(srv.ShutdownDrainDelay)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), srv.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := a.Scheduler.Stop(stopCtx); err != nil {
+		errs = append(errs, fmt.Errorf("stop jobs: %w", err))
+	}
+	if err := a.Server.Shutdown(stopCtx); err != nil {
+		errs = append(errs, fmt.Errorf("finish requests: %w", err))
+	}
+	if err := a.metricsServer.Shutdown(stopCtx); err != nil {
+		errs = append(errs, fmt.Errorf("stop metrics server: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases what New acquired: the listeners, the change listener, the
+// database pool unless it was injected, and the tracer after flushing its
+// spans. Call it after Run returns, as the requests and jobs use the pool
+// until then.
+func (a *App) Close() error {
+	var errs []error
+	if a.Server != nil {
+		// Closes the listener as well once Run has served on it.
+		if err := a.Server.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close server: %w", err))
+		}
+	}
+	if a.listener != nil {
+		if err := a.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("close listener: %w", err))
+		}
+	}
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close metrics server: %w", err))
+		}
+	}
+	if a.metricsListener != nil {
+		if err := a.metricsListener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, fmt.Errorf("close metrics listener: %w", err))
+		}
+	}
+	if a.changes != nil {
+		if err := a.changes.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close change listener: %w", err))
+		}
+	}
+	if a.jobsDB != nil && a.jobsDB != a.db {
+		if err := a.jobsDB.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close jobs database: %w", err))
+		}
+	}
+	if a.db != nil && a.ownDB {
+		if err := a.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close database: %w", err))
+		}
+	}
+	if a.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := a.shutdownTracing(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("flush traces: %w", err))
+		}
+	}
+	if a.log != nil {
+		_ = a.log.Sync()
+	}
+	return errors.Join(errs...)
+}
+
+func initLogger(cfg *config.Config) error {
+	return logger.Init(logger.Options{
+		Level:        cfg.Log.Level,
+		Format:       cfg.Log.Format,
+		Sampling:     cfg.Log.Sampling,
+		RedactFields: cfg.Log.RedactFields,
+	})
+}
+
+// connect prepares the logger and the database for the commands of the
+// binary, which need nothing else of the service.
+func connect(cfg *config.Config, dsn string) (*sqlx.DB, error) {
+	if err := initLogger(cfg); err != nil {
+		return nil, err
+	}
+	db, err := repository.ConnectWithRetry(dsn, logger.Get(), 10, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// middlewares lists the middleware chain of the API in order. Requests get
+// an ID and a trace and are logged first so that everything after,
+// including panics, can be traced back to them. With a nil authenticator
+// the API is served without authentication. Limits and timeouts are read
+// on every request, so that reloading the configuration changes them.
+// Rejected credentials are limited per IP inside authenticate, since the
+// per-client limit after it only knows callers that got through.
+func middlewares(authn *Authenticator, limits *atomic.Pointer[RateLimiter], timeouts *atomic.Pointer[RequestTimeouts]) []Middleware {
+	mws := []Middleware{withRequestID, traceHTTP, accessLog, observeHTTP, recoverPanic, withTimeout(timeouts)}
+	if authn != nil {
+		mws = append(mws, authenticate(authn, limits))
+	}
+	return append(mws, rateLimit(limits), resolveTenant(authn == nil))
+}
+
+func newRateLimitStore(cfg *config.Config, db *sqlx.DB) (ratelimit.Store, error) {
+	switch cfg.RateLimit.Store {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "postgres":
+		return postgres.NewRateLimitStore(db), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimit.Store)
+	}
+}
+
+// newMaintenance builds the jobs on db, which must see every tenant.
+func newMaintenance(db *sqlx.DB) *usecase.MaintenanceUseCase {
+	return usecase.NewMaintenanceUseCase(
+		postgres.NewMaintenanceRepo(db),
+		postgres.NewSpendRepo(db, false),
+		notify.NewLogNotifier(),
+	)
 }
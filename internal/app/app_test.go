@@ -0,0 +1,110 @@
+package app_test
+
+import (
+	"context"
+	"net/http"
+	"online-subscription/internal/app"
+	"online-subscription/internal/config"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testArgs = []string{
+	"-env-file=",
+	"-server.port=0",
+	"-server.metrics_port=0",
+	"-server.shutdown_drain_delay=0s",
+	"-db.user=test",
+	"-db.name=test",
+	"-db.auto_migrate=false",
+	"-auth.enabled=false",
+	"-jobs.enabled=false",
+}
+
+// TestBoot starts the whole service on free ports and stops it again. The
+// pool is never dialed: migrations are off and liveness doesn't touch the
+// database, so no PostgreSQL is needed.
+func TestBoot(t *testing.T) {
+	cfg, _, err := config.Load(testArgs)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	db, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	application, err := app.New(ctx, cfg, app.WithDB(db), app.WithLogger(zaptest.NewLogger(t)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- application.Run(ctx) }()
+
+	for _, url := range []string{
+		"http://" + application.Addr().String() + "/healthz",
+		"http://" + application.MetricsAddr().String() + "/metrics",
+	} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d, want %d", url, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+	if err := application.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+// TestReloadWarnsUntilRestart checks that a changed setting which needs a
+// restart is reported on every reload, not only the first one.
+func TestReloadWarnsUntilRestart(t *testing.T) {
+	cfg, _, err := config.Load(testArgs)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	db, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	defer db.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	application, err := app.New(context.Background(), cfg, app.WithDB(db), app.WithLogger(zap.New(core)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer application.Close()
+
+	next, _, err := config.Load(append(testArgs, "-server.shutdown_timeout=1m"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := application.Reload(next); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	if n := logs.FilterMessage("Changed settings take effect after a restart").Len(); n != 2 {
+		t.Errorf("restart warnings: got %d, want 2", n)
+	}
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler with behaviour shared by all routes.
+type Middleware func(http.Handler) http.Handler
+
+// chain wraps h so that requests pass through mws in order: the first
+// middleware is the outermost.
+func chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// matchRoute returns the entry of routes whose key is the longest prefix of
+// path.
+func matchRoute[T any](routes map[string]T, path string) (string, T, bool) {
+	route := ""
+	for prefix := range routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(route) {
+			route = prefix
+		}
+	}
+
+	v, ok := routes[route]
+	return route, v, ok && route != ""
+}
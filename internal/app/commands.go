@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"online-subscription/internal/config"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/repository/postgres"
+	"online-subscription/internal/tenant"
+	"online-subscription/internal/usecase"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// CheckSpend compares the monthly_spend aggregates with the live
+// calculation, prints every mismatch to out and reports whether they agree.
+func CheckSpend(ctx context.Context, cfg *config.Config, out io.Writer) (bool, error) {
+	db, err := connect(cfg, cfg.JobsDSN())
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+	defer logger.Sync()
+
+	diff, err := newMaintenance(db).CheckMonthlySpend(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, m := range diff {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\tstored=%d\tlive=%d\n",
+			m.TenantID, m.UserID, m.ServiceName, m.Month.Format("01-2006"), m.Stored, m.Live)
+	}
+	fmt.Fprintf(out, "%d mismatched months\n", len(diff))
+
+	return len(diff) == 0, nil
+}
+
+// CreateAPIKey issues an API key of a tenant outside of the HTTP API, which
+// is how the first admin key is bootstrapped. The plain key is printed to
+// out.
+func CreateAPIKey(ctx context.Context, cfg *config.Config, out io.Writer, tenantID, name string, scopes []string) error {
+	if !tenant.Valid(tenantID) {
+		return fmt.Errorf("invalid tenant ID %q", tenantID)
+	}
+	ctx = tenant.WithTenant(ctx, tenantID)
+
+	db, err := connect(cfg, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer logger.Sync()
+
+	// Without a principal in ctx the command is an internal call, which the
+	// authorizer lets through whatever the policy.
+	authz := rbac.NewAuthorizer(rbac.DefaultPolicy(), postgres.NewAuditRepo(db, cfg.DB.TenantRLS))
+	k, plain, err := usecase.NewAPIKeyUseCase(postgres.NewAPIKeyRepo(db, cfg.DB.TenantRLS), authz).Create(ctx, name, scopes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "id:     %s\ntenant: %s\nname:   %s\nscopes: %v\nkey:    %s\n",
+		k.ID, k.TenantID, k.Name, k.Scopes, plain)
+	return nil
+}
+
+// MigrateUsage describes the arguments of Migrate.
+const MigrateUsage = "usage: migrate up [N] | down [N] | goto V | version | force V | roundtrip"
+
+// Migrate changes the schema of the configured database: up applies N
+// migrations or all of them, down reverts N or one, goto moves to version V
+// in either direction and force marks V as applied without running it, to
+// recover from a migration that failed halfway. Every command prints the
+// resulting version to out. roundtrip checks that every migration can be
+// reverted, on a database never migrated; see repository.RoundTrip.
+func Migrate(ctx context.Context, cfg *config.Config, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(MigrateUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	n := -1
+	switch {
+	case (cmd == "version" || cmd == "roundtrip") && len(args) == 0:
+	case (cmd == "up" || cmd == "down") && len(args) <= 1,
+		(cmd == "goto" || cmd == "force") && len(args) == 1:
+		if len(args) == 1 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v < 0 || (v == 0 && cmd != "force") {
+				return fmt.Errorf("%s: %q is not a valid number", cmd, args[0])
+			}
+			n = v
+		}
+	default:
+		return errors.New(MigrateUsage)
+	}
+
+	db, err := connect(cfg, cfg.DSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer logger.Sync()
+
+	if cmd == "roundtrip" {
+		return repository.RoundTrip(ctx, db, cfg.DB.Migrations, out)
+	}
+
+	m, err := repository.NewMigrator(db, cfg.DB.Migrations)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	m.Log = migrateLog{out}
+
+	// Interrupting the command stops after the migration in progress.
+	go func() {
+		<-ctx.Done()
+		select {
+		case m.GracefulStop <- true:
+		default:
+		}
+	}()
+
+	switch cmd {
+	case "up":
+		if n < 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+	case "down":
+		if n < 0 {
+			n = 1
+		}
+		err = m.Steps(-n)
+	case "goto":
+		err = m.Migrate(uint(n))
+	case "force":
+		err = m.Force(n)
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Fprintln(out, "no change")
+	} else if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		fmt.Fprintln(out, "version: none")
+	case err != nil:
+		return err
+	case dirty:
+		fmt.Fprintf(out, "version: %d (dirty)\n", version)
+	default:
+		fmt.Fprintf(out, "version: %d\n", version)
+	}
+	return nil
+}
+
+// migrateLog prints the progress of Migrate.
+type migrateLog struct {
+	out io.Writer
+}
+
+func (l migrateLog) Printf(format string, v ...any) {
+	fmt.Fprintf(l.out, format, v...)
+}
+
+func (l migrateLog) Verbose() bool {
+	return false
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"online-subscription/internal/repository"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// healthTimeout bounds the dependency checks of a single readiness probe.
+const healthTimeout = 2 * time.Second
+
+type workers interface {
+	Running() bool
+}
+
+// Health answers the liveness and readiness probes of the orchestrator.
+// Readiness requires the database to respond, the schema to be at the
+// version of the shipped migrations and the background workers to run.
+type Health struct {
+	db        *sqlx.DB
+	workers   workers
+	migration uint
+	draining  atomic.Bool
+}
+
+func NewHealth(db *sqlx.DB, workers workers, migration uint) *Health {
+	return &Health{db: db, workers: workers, migration: migration}
+}
+
+// Drain makes the readiness probe fail so that the orchestrator stops
+// sending traffic before the server shuts down.
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so that their outages don't get the process restarted.
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthReport{Status: "ok"})
+}
+
+// Ready runs every check and answers 503 when any of them fails or the
+// server is shutting down.
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthReport{Status: "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	report := healthReport{
+		Status: "ok",
+		Checks: map[string]healthCheck{
+			"database":   result(h.db.PingContext(ctx)),
+			"migrations": result(h.checkMigrations(ctx)),
+			"workers":    result(h.checkWorkers()),
+		},
+	}
+
+	status := http.StatusOK
+	for _, c := range report.Checks {
+		if c.Status != "ok" {
+			report.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, status, report)
+}
+
+func (h *Health) checkMigrations(ctx context.Context) error {
+	version, dirty, err := repository.MigrationVersion(ctx, h.db)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed halfway", version)
+	}
+	if version != h.migration {
+		return fmt.Errorf("schema is at version %d, expected %d", version, h.migration)
+	}
+	return nil
+}
+
+func (h *Health) checkWorkers() error {
+	if !h.workers.Running() {
+		return errors.New("scheduler is not running")
+	}
+	return nil
+}
+
+func result(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Status: "failing", Error: err.Error()}
+	}
+	return healthCheck{Status: "ok"}
+}
+
+func writeHealth(w http.ResponseWriter, status int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,22 @@
+package app
+
+import (
+	"online-subscription/internal/config"
+	"online-subscription/internal/scheduler"
+	"online-subscription/internal/usecase"
+)
+
+func registerJobs(s *scheduler.Scheduler, cfg *config.Config, uc *usecase.MaintenanceUseCase) error {
+	jobs := []scheduler.Job{
+		{Name: "expire-subscriptions", Schedule: cfg.Jobs.ExpireSubscriptions, Run: uc.ExpireEnded},
+		{Name: "renewal-reminders", Schedule: cfg.Jobs.RenewalReminders, Run: uc.SendRenewalReminders},
+		{Name: "monthly-spend", Schedule: cfg.Jobs.MonthlySpend, Run: uc.RebuildMonthlySpend},
+	}
+
+	for _, job := range jobs {
+		if err := s.Register(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"online-subscription/internal/auth"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/tenant"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// publicPaths are served without authentication.
+var publicPaths = []string{"/swagger/", "/healthz", "/readyz"}
+
+// tenantHeader names the tenant of a request when authentication is off.
+const tenantHeader = "X-Tenant-ID"
+
+type apiKeyVerifier interface {
+	VerifyKey(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// Authenticator accepts JWTs as "Authorization: Bearer ..." and API keys as
+// "Authorization: ApiKey ...". Either verifier may be nil to turn its scheme
+// off.
+type Authenticator struct {
+	JWT     *auth.JWTVerifier
+	APIKeys apiKeyVerifier
+}
+
+// authenticate requires valid credentials on every request outside
+// publicPaths and stores the caller in the request context. Rejected
+// credentials count against the auth failure limit of the remote IP.
+func authenticate(a *Authenticator, limits *atomic.Pointer[RateLimiter]) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range publicPaths {
+				if strings.HasPrefix(r.URL.Path, p) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			credentials = strings.TrimSpace(credentials)
+			if !ok || credentials == "" {
+				unauthorized(w, "missing credentials")
+				return
+			}
+
+			var (
+				principal *auth.Principal
+				err       error
+			)
+			switch {
+			case strings.EqualFold(scheme, "Bearer") && a.JWT != nil:
+				principal, err = a.JWT.Verify(credentials)
+			case strings.EqualFold(scheme, "ApiKey") && a.APIKeys != nil:
+				principal, err = a.APIKeys.VerifyKey(r.Context(), credentials)
+			default:
+				unauthorized(w, "unsupported authorization scheme")
+				return
+			}
+			if err != nil {
+				logger.FromContext(r.Context()).Warn("Rejected credentials",
+					zap.String("scheme", scheme),
+					zap.Error(err),
+				)
+				if limits.Load().authFailed(w, r) {
+					return
+				}
+				unauthorized(w, "invalid credentials")
+				return
+			}
+
+			if principal.IsService() {
+				logger.AddFields(r.Context(), zap.String("api_key_id", principal.APIKeyID))
+			} else {
+				logger.AddFields(r.Context(), zap.String("user_id", principal.UserID))
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// resolveTenant stores the tenant of the request in its context. With
+// authentication it is the tenant bound to the credentials, or
+// tenant.Default for credentials without one, and a header naming another
+// tenant is refused: letting the caller pick would open every tenant to
+// anyone holding a token. Only without authentication, when there are no
+// credentials to bind to, does the header choose.
+func resolveTenant(trustHeader bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get(tenantHeader)
+
+			id := tenant.Default
+			if p, ok := auth.FromContext(r.Context()); ok && p.TenantID != "" {
+				id = p.TenantID
+			}
+			if trustHeader && header != "" {
+				id = header
+			}
+
+			if !tenant.Valid(id) {
+				http.Error(w, "invalid tenant ID", http.StatusBadRequest)
+				return
+			}
+			if header != "" && header != id {
+				http.Error(w, "credentials do not belong to tenant "+header, http.StatusForbidden)
+				return
+			}
+
+			logger.AddFields(r.Context(), zap.String("tenant_id", id))
+			next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), id)))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="online-subscription"`)
+	w.Header().Add("WWW-Authenticate", `ApiKey realm="online-subscription"`)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
@@ -0,0 +1,255 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/metrics"
+	"online-subscription/internal/requestid"
+	"online-subscription/internal/tracing"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.uber.org/zap"
+)
+
+// withRequestID reuses a valid X-Request-ID of the client or generates
+// one, stores it in the request context and echoes it in the response. It
+// also starts the log fields of the request, which later middleware extend.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		ctx := requestid.WithRequestID(r.Context(), id)
+		ctx = logger.NewContext(ctx,
+			zap.String("request_id", id),
+			zap.String("route", r.Method+" "+r.URL.Path),
+		)
+
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// traceHTTP continues the trace of the caller given in the W3C traceparent
+// header, or starts a new one, with a server span per request named after
+// the route template. The trace ID is added to the log fields.
+func traceHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		route := routeTemplate(r.URL.Path)
+		ctx, span := tracing.StartServer(ctx, r.Method+" "+route,
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.HTTPRoute(route),
+			semconv.URLPath(r.URL.Path),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			logger.AddFields(ctx, zap.String("trace_id", sc.TraceID().String()))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder remembers what was written so it can be logged.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush and deadlines of the
+// underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// accessLog logs every request once it has been served.
+func accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		logger.FromContext(r.Context()).Info("HTTP request",
+			zap.Int("status", rec.status),
+			zap.Int("bytes", rec.bytes),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+// observeHTTP records request counts and latencies per route template.
+func observeHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.ObserveHTTP(routeTemplate(r.URL.Path), r.Method, rec.status, time.Since(start))
+	})
+}
+
+// routeTemplate replaces the IDs in a path with placeholders so that
+// metrics get one series per route rather than per resource.
+func routeTemplate(path string) string {
+	if strings.HasPrefix(path, "/swagger/") {
+		return "/swagger/*"
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		if s != "" && !routeWords[s] {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// routeWords are the fixed path segments of the API.
+var routeWords = map[string]bool{
+	"subscriptions": true, "summary": true, "changes": true, "stream": true, "pause": true, "resume": true, "members": true,
+	"users": true, "budgets": true, "status": true, "api-keys": true, "metrics": true,
+	"healthz": true, "readyz": true, "admin": true, "log-level": true,
+}
+
+// recoverPanic turns a panicking handler into a logged 500 response
+// instead of a dropped connection.
+func recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			id := requestid.FromContext(r.Context())
+			logger.FromContext(r.Context()).Error("Handler panicked",
+				zap.String("panic", fmt.Sprint(v)),
+				zap.ByteString("stack", debug.Stack()),
+			)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":      "internal server error",
+				"request_id": id,
+			})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestTimeouts bounds how long a request may take through its context,
+// which cancels the queries it runs. Routes are matched by the longest
+// configured path prefix; a zero duration means no deadline.
+type RequestTimeouts struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// ParseRequestTimeouts reads the default timeout and per-route timeouts
+// written as "/path=30s,...".
+func ParseRequestTimeouts(def time.Duration, routes string) (*RequestTimeouts, error) {
+	t := &RequestTimeouts{Default: def, Routes: make(map[string]time.Duration)}
+
+	for _, entry := range strings.Split(routes, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		path, timeout, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route timeout %q is not in the form /path=duration", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(timeout))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("route timeout %q: invalid duration", entry)
+		}
+		t.Routes[path] = d
+	}
+	return t, nil
+}
+
+func (t *RequestTimeouts) forPath(path string) time.Duration {
+	if _, d, ok := matchRoute(t.Routes, path); ok {
+		return d
+	}
+	// Streams stay open as long as the client does unless a route says
+	// otherwise.
+	if streamingPaths[path] {
+		return 0
+	}
+	return t.Default
+}
+
+var streamingPaths = map[string]bool{"/subscriptions/stream": true}
+
+func withTimeout(timeouts *atomic.Pointer[RequestTimeouts]) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeouts.Load().forPath(r.URL.Path)
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"online-subscription/internal/auth"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/ratelimit"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateLimiter limits requests per client with token buckets. Routes are
+// matched by the longest configured path prefix; requests to other routes
+// fall under Default, which may be nil to leave them unlimited. Every route
+// prefix has buckets of its own. AuthFailures, when set, limits rejected
+// credentials per remote IP.
+type RateLimiter struct {
+	Store        ratelimit.Store
+	Default      *ratelimit.Limit
+	Routes       map[string]ratelimit.Limit
+	AuthFailures *ratelimit.Limit
+}
+
+// ParseRateLimits reads the default limit ("rate:burst", empty for none),
+// per-route limits ("/path=rate:burst,...") and the limit of failed
+// authentications per IP ("rate:burst", empty for none). It returns nil
+// when nothing is limited.
+func ParseRateLimits(store ratelimit.Store, def, routes, authFailures string) (*RateLimiter, error) {
+	rl := &RateLimiter{Store: store, Routes: make(map[string]ratelimit.Limit)}
+
+	var err error
+	if rl.Default, err = parseOptionalLimit(def); err != nil {
+		return nil, err
+	}
+	if rl.AuthFailures, err = parseOptionalLimit(authFailures); err != nil {
+		return nil, fmt.Errorf("auth failures: %w", err)
+	}
+
+	for _, entry := range strings.Split(routes, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		path, limit, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route limit %q is not in the form /path=rate:burst", entry)
+		}
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		rl.Routes[path] = l
+	}
+
+	if rl.Default == nil && len(rl.Routes) == 0 && rl.AuthFailures == nil {
+		return nil, nil
+	}
+	return rl, nil
+}
+
+func parseOptionalLimit(s string) (*ratelimit.Limit, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	l, err := ratelimit.ParseLimit(s)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (rl *RateLimiter) limitFor(path string) (string, ratelimit.Limit, bool) {
+	if route, l, ok := matchRoute(rl.Routes, path); ok {
+		return route, l, true
+	}
+	if rl.Default != nil {
+		return "*", *rl.Default, true
+	}
+	return "", ratelimit.Limit{}, false
+}
+
+// rateLimit answers 429 once a client has used up its bucket. Clients are
+// told apart by API key, then user, then remote IP. If the store fails the
+// request is let through rather than taking the API down with it. A nil
+// limiter leaves every route unlimited.
+func rateLimit(limits *atomic.Pointer[RateLimiter]) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rl := limits.Load()
+			if rl == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			route, limit, ok := rl.limitFor(r.URL.Path)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := rl.Store.Take(r.Context(), route+"|"+clientKey(r), limit)
+			if err != nil {
+				logger.FromContext(r.Context()).Error("Rate limit store failed", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authFailed counts rejected credentials against the remote IP and, once
+// the IP has used up its failures, answers 429 in place of the 401 and
+// reports true. Only failures are counted: valid credentials pass however
+// many failures came from their address, such as a NAT shared with
+// someone guessing.
+func (rl *RateLimiter) authFailed(w http.ResponseWriter, r *http.Request) bool {
+	if rl == nil || rl.AuthFailures == nil {
+		return false
+	}
+
+	res, err := rl.Store.Take(r.Context(), authFailureKey(r), *rl.AuthFailures)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Rate limit store failed", zap.Error(err))
+		return false
+	}
+	if res.Allowed {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	http.Error(w, "too many failed authentication attempts", http.StatusTooManyRequests)
+	return true
+}
+
+func authFailureKey(r *http.Request) string {
+	return "auth-failures|" + ipKey(r)
+}
+
+func clientKey(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		if p.IsService() {
+			return "key:" + p.APIKeyID
+		}
+		return "user:" + p.UserID
+	}
+	return ipKey(r)
+}
+
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"online-subscription/internal/config"
+	"online-subscription/internal/logger"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// Reload applies the settings of cfg that can change at runtime and warns
+// about changed settings that need a restart. The new values are checked
+// first; if any is invalid nothing is applied. Settings that need a restart
+// are compared with the startup configuration, so they are reported on
+// every reload until the app is restarted.
+func (a *App) Reload(cfg *config.Config) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	reload, _ := config.Diff(a.applied, cfg)
+	_, restart := config.Diff(a.cfg, cfg)
+	if len(restart) > 0 {
+		a.log.Warn("Changed settings take effect after a restart", zap.Strings("settings", restart))
+	}
+
+	limits, err := ParseRateLimits(a.limitStore, cfg.RateLimit.Default, cfg.RateLimit.Routes, cfg.RateLimit.AuthFailures)
+	if err != nil {
+		return fmt.Errorf("rate limits: %w", err)
+	}
+	timeouts, err := ParseRequestTimeouts(cfg.Server.RequestTimeout, cfg.Server.RequestTimeoutRoutes)
+	if err != nil {
+		return fmt.Errorf("request timeouts: %w", err)
+	}
+
+	// The level may have been changed through the admin API since, which
+	// holds until the configured level itself changes.
+	if cfg.Log.Level != a.applied.Log.Level {
+		if err := logger.SetLevel(cfg.Log.Level); err != nil {
+			return err
+		}
+	}
+	a.limits.Store(limits)
+	a.timeouts.Store(timeouts)
+	a.applied = config.Reloaded(a.cfg, cfg)
+
+	if len(reload) > 0 {
+		a.log.Info("Configuration reloaded", zap.Strings("settings", reload))
+	}
+	return nil
+}
+
+// WatchConfig reloads the configuration on SIGHUP and whenever one of its
+// files changes, until ctx is done. args are the command-line arguments the
+// configuration was loaded with.
+func (a *App) WatchConfig(ctx context.Context, args []string) {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	if interval := a.cfg.Reload.WatchInterval; interval > 0 && len(a.cfg.Files) > 0 {
+		go config.Watch(ctx, a.cfg.Files, interval, notify)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			a.log.Info("SIGHUP received, reloading configuration")
+		case <-changed:
+			a.log.Info("Configuration files changed, reloading")
+		}
+
+		cfg, _, err := config.Load(args)
+		if err == nil {
+			err = a.Reload(cfg)
+		}
+		if err != nil {
+			a.log.Error("Configuration not reloaded, keeping the current one", zap.Error(err))
+		}
+	}
+}
@@ -8,7 +8,16 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-func NewRouter(h *handler.SubscriptionHandler) *http.ServeMux {
+// NewRouter builds the HTTP routes and wraps them in mws, the first being
+// the outermost.
+func NewRouter(
+	h *handler.SubscriptionHandler,
+	bh *handler.BudgetHandler,
+	kh *handler.APIKeyHandler,
+	sh *handler.SettingsHandler,
+	health *Health,
+	mws ...Middleware,
+) http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/subscriptions/summary", func(w http.ResponseWriter, r *http.Request) {
@@ -19,6 +28,22 @@ func NewRouter(h *handler.SubscriptionHandler) *http.ServeMux {
 		h.Summary(w, r)
 	})
 
+	mux.HandleFunc("/subscriptions/changes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Changes(w, r)
+	})
+
+	mux.HandleFunc("/subscriptions/stream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Stream(w, r)
+	})
+
 	mux.HandleFunc("/subscriptions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -31,12 +56,17 @@ func NewRouter(h *handler.SubscriptionHandler) *http.ServeMux {
 	})
 
 	mux.HandleFunc("/subscriptions/", func(w http.ResponseWriter, r *http.Request) {
-		id := strings.TrimPrefix(r.URL.Path, "/subscriptions/")
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/subscriptions/"), "/")
 		if id == "" {
 			http.Error(w, "id is required", http.StatusBadRequest)
 			return
 		}
 
+		if action != "" {
+			routeSubscriptionAction(w, r, h, id, action)
+			return
+		}
+
 		switch r.Method {
 		case http.MethodGet:
 			h.GetById(w, r, id)
@@ -49,6 +79,113 @@ func NewRouter(h *handler.SubscriptionHandler) *http.ServeMux {
 		}
 	})
 
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/users/"), "/"), "/")
+		if len(parts) < 2 || parts[0] == "" || parts[1] != "budgets" {
+			http.NotFound(w, r)
+			return
+		}
+		userID := parts[0]
+
+		switch {
+		case len(parts) == 2:
+			switch r.Method {
+			case http.MethodGet:
+				bh.List(w, r, userID)
+			case http.MethodPost:
+				bh.Create(w, r, userID)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		case len(parts) == 3 && parts[2] == "status":
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			bh.Status(w, r, userID)
+		case len(parts) == 3:
+			if r.Method != http.MethodDelete {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			bh.Delete(w, r, userID, parts[2])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	mux.HandleFunc("/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			kh.List(w, r)
+		case http.MethodPost:
+			kh.Create(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api-keys/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api-keys/")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		kh.Revoke(w, r, id)
+	})
+
+	mux.HandleFunc("/admin/log-level", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			sh.LogLevel(w, r)
+		case http.MethodPut:
+			sh.SetLogLevel(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	mux.Handle("/swagger/", httpSwagger.WrapHandler)
-	return mux
+	mux.HandleFunc("GET /healthz", health.Live)
+	mux.HandleFunc("GET /readyz", health.Ready)
+
+	return chain(mux, mws...)
+}
+
+func routeSubscriptionAction(w http.ResponseWriter, r *http.Request, h *handler.SubscriptionHandler, id, action string) {
+	action, memberID, _ := strings.Cut(action, "/")
+
+	switch {
+	case action == "pause" || action == "resume":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if action == "pause" {
+			h.Pause(w, r, id)
+		} else {
+			h.Resume(w, r, id)
+		}
+	case action == "members" && memberID == "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ListMembers(w, r, id)
+	case action == "members":
+		switch r.Method {
+		case http.MethodPut:
+			h.SaveMember(w, r, id, memberID)
+		case http.MethodDelete:
+			h.RemoveMember(w, r, id, memberID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
 }
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"online-subscription/internal/config"
+	"online-subscription/internal/metrics"
+	"os"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newServer builds the HTTP server of the API. Certificates are loaded here
+// so that a broken TLS setup fails at startup rather than on the first
+// handshake.
+func newServer(cfg config.ServerConfig, h http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(cfg.HTTP2)
+	srv.Protocols.SetUnencryptedHTTP2(cfg.H2C)
+
+	if cfg.TLS.Enabled() {
+		tlsCfg, err := newTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		srv.TLSConfig = tlsCfg
+	}
+	return srv, nil
+}
+
+// newMetricsServer builds the plain HTTP server of /metrics on its own
+// port, serving reg. Prometheus scrapes it from inside the network, so it
+// has neither TLS nor authentication.
+func newMetricsServer(cfg config.ServerConfig, reg *prometheus.Registry) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler(reg))
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.ClientCAFile == "" {
+		return tlsCfg, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA %s contains no certificates", cfg.ClientCAFile)
+	}
+	tlsCfg.ClientCAs = pool
+
+	switch cfg.ClientAuth {
+	case "optional":
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
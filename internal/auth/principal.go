@@ -0,0 +1,56 @@
+package auth
+
+import "context"
+
+const RoleAdmin = "admin"
+
+// Principal is the authenticated caller of a request: a user identified by
+// a JWT, or a service client identified by an API key. Service clients have
+// no UserID and are limited by Scopes instead. TenantID is empty when the
+// credentials are not bound to a tenant.
+type Principal struct {
+	UserID   string
+	TenantID string
+	Roles    []string
+	APIKeyID string
+	Scopes   []string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(RoleAdmin)
+}
+
+func (p *Principal) IsService() bool {
+	return p.APIKeyID != ""
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the caller of the request. ok is false for internal
+// calls such as background jobs and when authentication is disabled.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
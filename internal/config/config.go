@@ -1,47 +1,250 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"strconv"
-
-	"github.com/joho/godotenv"
+	"strings"
+	"time"
 )
 
+// Config is the configuration of the service. Every setting has a YAML key,
+// an environment variable and a command-line flag named after the YAML path
+// (-db.host); see Load for their precedence. Fields tagged secret are masked
+// by Print, and those tagged reload can change without a restart.
 type Config struct {
-	AppPort    string
-	DBHost     string
-	DBPort     int
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBSSLMode  string
-	LogLevel   string
-}
-
-func LoadConfig(path string) *Config {
-	if err := godotenv.Load(path); err != nil {
-		log.Printf("Warning: no .env file found at %s", path)
+	Server    ServerConfig    `yaml:"server"`
+	DB        DBConfig        `yaml:"db"`
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	Reload    ReloadConfig    `yaml:"reload"`
+
+	// Files are the configuration and env files the settings were read
+	// from, which are watched for changes.
+	Files []string `yaml:"-"`
+}
+
+type ServerConfig struct {
+	// Port 0 listens on a free port chosen by the system.
+	Port int `yaml:"port" env:"APP_PORT" default:"8080"`
+	// MetricsPort serves /metrics apart from the API, so that it can be
+	// kept out of reach of API clients. Port 0 works as for Port.
+	MetricsPort int `yaml:"metrics_port" env:"METRICS_PORT" default:"9090"`
+
+	// RequestTimeout bounds every request unless RequestTimeoutRoutes
+	// ("/path=30s,...") sets another limit for its route. Zero disables it.
+	RequestTimeout       time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT" default:"10s" reload:"true"`
+	RequestTimeoutRoutes string        `yaml:"request_timeout_routes" env:"REQUEST_TIMEOUT_ROUTES" reload:"true"`
+
+	// Timeouts of the connection itself; zero disables one. WriteTimeout
+	// must leave room for the slowest request timeout.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT" default:"5s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT" default:"15s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT" default:"60s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT" default:"120s"`
+
+	// HTTP2 enables HTTP/2 over TLS and H2C HTTP/2 without TLS, for proxies
+	// that speak it with prior knowledge.
+	HTTP2 bool `yaml:"http2" env:"SERVER_HTTP2" default:"true"`
+	H2C   bool `yaml:"h2c" env:"SERVER_H2C"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	// ShutdownDrainDelay is how long /readyz fails before the server stops
+	// accepting requests, so that the orchestrator routes traffic away.
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" env:"SHUTDOWN_DRAIN_DELAY" default:"5s"`
+	// ShutdownTimeout bounds stopping the workers, finishing in-flight
+	// requests and closing the database after the drain delay.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+}
+
+// TLSConfig turns on HTTPS when a certificate is set. With a client CA the
+// server verifies client certificates: ClientAuth "optional" checks those
+// presented, "require" rejects connections without one.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile      string `yaml:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile string `yaml:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	ClientAuth   string `yaml:"client_auth" env:"TLS_CLIENT_AUTH" default:"none"`
+}
+
+// Enabled reports whether the server speaks HTTPS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+type DBConfig struct {
+	Host     string `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Port     int    `yaml:"port" env:"DB_PORT" default:"5432"`
+	User     string `yaml:"user" env:"DB_USER"`
+	Password string `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" env:"DB_NAME"`
+	SSLMode  string `yaml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+
+	// Migrations is the source URL of the schema migrations, such as
+	// file:///path; empty uses those embedded in the binary.
+	Migrations string `yaml:"migrations" env:"MIGRATIONS_SOURCE"`
+	// AutoMigrate applies the migrations on startup. Turn it off where a
+	// separate job runs "migrate up" before the service is deployed.
+	AutoMigrate bool `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE" default:"true"`
+
+	// TenantRLS makes the application set app.tenant_id for the row-level
+	// security policies. They only bind roles that don't own the tables.
+	TenantRLS bool `yaml:"tenant_rls" env:"TENANT_RLS"`
+	// JobsUser and JobsPassword are the role of the background jobs, the
+	// business metrics and check-spend, which work across all tenants. It
+	// must own the tables or have BYPASSRLS when the policies bind User.
+	// Empty uses User.
+	JobsUser     string `yaml:"jobs_user" env:"DB_JOBS_USER"`
+	JobsPassword string `yaml:"jobs_password" env:"DB_JOBS_PASSWORD" secret:"true"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"INFO" reload:"true"`
+	// Format is "console" or "json".
+	Format       string   `yaml:"format" env:"LOG_FORMAT" default:"console"`
+	Sampling     bool     `yaml:"sampling" env:"LOG_SAMPLING"`
+	RedactFields []string `yaml:"redact_fields" env:"LOG_REDACT_FIELDS"`
+}
+
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp"; the OTLP endpoint is read from
+	// the standard OTEL_EXPORTER_OTLP_* variables.
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" default:"none"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" default:"1"`
+}
+
+// minHS256SecretLen is the shortest HS256 secret accepted, as many bytes as
+// the HMAC-SHA256 output.
+const minHS256SecretLen = 32
+
+// placeholderHS256Secret is the value earlier examples shipped with, which
+// anybody can sign tokens with.
+const placeholderHS256Secret = "change-me-in-production"
+
+type AuthConfig struct {
+	Enabled            bool   `yaml:"enabled" env:"AUTH_ENABLED" default:"true"`
+	HS256Secret        string `yaml:"hs256_secret" env:"JWT_HS256_SECRET" secret:"true"`
+	RS256PublicKeyFile string `yaml:"rs256_public_key_file" env:"JWT_RS256_PUBLIC_KEY_FILE"`
+	JWKSFile           string `yaml:"jwks_file" env:"JWT_JWKS_FILE"`
+	Issuer             string `yaml:"issuer" env:"JWT_ISSUER"`
+	Audience           string `yaml:"audience" env:"JWT_AUDIENCE"`
+	PolicyFile         string `yaml:"policy_file" env:"POLICY_FILE"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory" or "postgres"; the latter shares limits between
+	// replicas.
+	Store   string `yaml:"store" env:"RATE_LIMIT_STORE" default:"memory"`
+	Default string `yaml:"default" env:"RATE_LIMIT_DEFAULT" reload:"true"`
+	Routes  string `yaml:"routes" env:"RATE_LIMIT_ROUTES" reload:"true"`
+	// AuthFailures limits rejected credentials per remote IP.
+	AuthFailures string `yaml:"auth_failures" env:"RATE_LIMIT_AUTH_FAILURES" default:"0.1:10" reload:"true"`
+}
+
+// JobsConfig holds cron schedules of the background jobs; an empty one
+// disables its job.
+type JobsConfig struct {
+	Enabled             bool   `yaml:"enabled" env:"JOBS_ENABLED" default:"true"`
+	ExpireSubscriptions string `yaml:"expire_subscriptions" env:"JOB_EXPIRE_SUBSCRIPTIONS_CRON" default:"5 0 * * *"`
+	RenewalReminders    string `yaml:"renewal_reminders" env:"JOB_RENEWAL_REMINDERS_CRON" default:"0 9 * * *"`
+	MonthlySpend        string `yaml:"monthly_spend" env:"JOB_MONTHLY_SPEND_CRON" default:"30 0 * * *"`
+}
+
+type ReloadConfig struct {
+	// WatchInterval is how often the files are checked for changes. Zero
+	// leaves reloading to SIGHUP.
+	WatchInterval time.Duration `yaml:"watch_interval" env:"CONFIG_WATCH_INTERVAL" default:"10s"`
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	dbPort, _ := strconv.Atoi(os.Getenv("DB_PORT"))
-
-	return &Config{
-		AppPort:    os.Getenv("APP_PORT"),
-		DBHost:     os.Getenv("DB_HOST"),
-		DBPort:     dbPort,
-		DBUser:     os.Getenv("DB_USER"),
-		DBPassword: os.Getenv("DB_PASSWORD"),
-		DBName:     os.Getenv("DB_NAME"),
-		DBSSLMode:  os.Getenv("DB_SSLMODE"),
-		LogLevel:   os.Getenv("LOG_LEVEL"),
+	check(c.Server.Port >= 0 && c.Server.Port < 65536, "server.port: %d is not a valid port", c.Server.Port)
+	check(c.Server.MetricsPort >= 0 && c.Server.MetricsPort < 65536,
+		"server.metrics_port: %d is not a valid port", c.Server.MetricsPort)
+	check(c.Server.MetricsPort == 0 || c.Server.MetricsPort != c.Server.Port,
+		"server.metrics_port: must differ from server.port")
+	check(c.Server.RequestTimeout >= 0, "server.request_timeout: must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 &&
+		c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server: connection timeouts must not be negative")
+	check(c.Server.WriteTimeout == 0 || c.Server.RequestTimeout == 0 || c.Server.WriteTimeout >= c.Server.RequestTimeout,
+		"server.write_timeout: %s is shorter than server.request_timeout %s", c.Server.WriteTimeout, c.Server.RequestTimeout)
+	check(c.Server.ShutdownDrainDelay >= 0, "server.shutdown_drain_delay: must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+
+	tls := c.Server.TLS
+	check((tls.CertFile == "") == (tls.KeyFile == ""), "server.tls: cert_file and key_file must be set together")
+	check(oneOf(tls.ClientAuth, "none", "optional", "require"),
+		"server.tls.client_auth: unknown mode %q, expected none, optional or require", tls.ClientAuth)
+	check(tls.ClientAuth == "none" || tls.ClientCAFile != "",
+		"server.tls.client_auth: %q needs client_ca_file", tls.ClientAuth)
+	check(tls.ClientCAFile == "" || tls.Enabled(), "server.tls.client_ca_file: needs cert_file and key_file")
+
+	check(c.DB.Host != "", "db.host: is required")
+	check(c.DB.Port > 0 && c.DB.Port < 65536, "db.port: %d is not a valid port", c.DB.Port)
+	check(c.DB.User != "", "db.user: is required")
+	check(c.DB.Name != "", "db.name: is required")
+	check(oneOf(c.DB.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+		"db.sslmode: unknown mode %q", c.DB.SSLMode)
+
+	check(oneOf(strings.ToUpper(c.Log.Level), "DEBUG", "INFO", "WARN", "ERROR"),
+		"log.level: unknown level %q, expected DEBUG, INFO, WARN or ERROR", c.Log.Level)
+	check(oneOf(c.Log.Format, "console", "json"), "log.format: unknown format %q, expected console or json", c.Log.Format)
+
+	check(oneOf(c.Tracing.Exporter, "none", "stdout", "otlp"),
+		"tracing.exporter: unknown exporter %q, expected none, stdout or otlp", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio: %v is not between 0 and 1", c.Tracing.SampleRatio)
+
+	if c.Auth.Enabled && c.Auth.HS256Secret != "" {
+		check(c.Auth.HS256Secret != placeholderHS256Secret,
+			"auth.hs256_secret: is the example placeholder, set a random secret")
+		check(len(c.Auth.HS256Secret) >= minHS256SecretLen,
+			"auth.hs256_secret: must be at least %d bytes", minHS256SecretLen)
 	}
+
+	check(oneOf(c.RateLimit.Store, "memory", "postgres"),
+		"rate_limit.store: unknown store %q, expected memory or postgres", c.RateLimit.Store)
+
+	check(c.Reload.WatchInterval >= 0, "reload.watch_interval: must not be negative")
+
+	return errors.Join(errs...)
 }
 
 func (c *Config) DSN() string {
 	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, c.DBSSLMode,
+		c.DB.Host, c.DB.Port, c.DB.User, c.DB.Password, c.DB.Name, c.DB.SSLMode,
+	)
+}
+
+// JobsDSN is the DSN of the role that sees every tenant, which is the one of
+// DSN unless a jobs user is configured.
+func (c *Config) JobsDSN() string {
+	if c.DB.JobsUser == "" {
+		return c.DSN()
+	}
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		c.DB.Host, c.DB.Port, c.DB.JobsUser, c.DB.JobsPassword, c.DB.Name, c.DB.SSLMode,
 	)
 }
+
+func oneOf(v string, allowed ...string) bool {
+	for _, a := range allowed {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
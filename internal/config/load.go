@@ -0,0 +1,306 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+const defaultEnvFile = ".env"
+
+// Load builds the configuration from, in increasing precedence: defaults,
+// the YAML file given by -config or CONFIG_FILE, environment variables
+// (including those of the -env-file, .env by default) and the flags in
+// args. It returns the arguments after the flags and every problem found,
+// both unparsable values and failed validation, joined in one error.
+func Load(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	settings := fields(reflect.ValueOf(cfg).Elem(), "")
+
+	fs := flag.NewFlagSet("online-subscription", flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML configuration file, overrides CONFIG_FILE")
+	envFile := fs.String("env-file", defaultEnvFile, "file with environment variables")
+
+	// Flags are applied last, so their values are only collected here.
+	var flagged []func() error
+	for _, s := range settings {
+		s := s
+		usage := "overrides " + s.env
+		set := func(v string) error {
+			flagged = append(flagged, func() error {
+				if err := s.set(v); err != nil {
+					return fmt.Errorf("-%s: %w", s.path, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(s.path, usage, set)
+		} else {
+			fs.Func(s.path, usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	loaded, err := loadEnvFile(*envFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if loaded {
+		cfg.Files = append(cfg.Files, *envFile)
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if s.def == "" {
+			continue
+		}
+		if err := s.set(s.def); err != nil {
+			errs = append(errs, fmt.Errorf("default of %s: %w", s.path, err))
+		}
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			errs = append(errs, err)
+		}
+		cfg.Files = append(cfg.Files, *configFile)
+	}
+
+	for _, s := range settings {
+		// A variable set to an empty value still overrides, so that it can
+		// switch a setting off.
+		v, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+		}
+	}
+
+	for _, apply := range flagged {
+		if err := apply(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Settings that failed to parse keep their previous value, so validating
+	// them as well reports nothing misleading.
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Print writes the configuration as YAML with secrets masked.
+func Print(w io.Writer, cfg *Config) error {
+	masked := *cfg
+	for _, s := range fields(reflect.ValueOf(&masked).Elem(), "") {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString("********")
+		}
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Diff lists the settings that differ between old and new, split into
+// those that can be applied at runtime and those that need a restart.
+func Diff(old, new *Config) (reload, restart []string) {
+	a := fields(reflect.ValueOf(old).Elem(), "")
+	b := fields(reflect.ValueOf(new).Elem(), "")
+	for i := range a {
+		if reflect.DeepEqual(a[i].value.Interface(), b[i].value.Interface()) {
+			continue
+		}
+		if a[i].reload {
+			reload = append(reload, a[i].path)
+		} else {
+			restart = append(restart, a[i].path)
+		}
+	}
+	return reload, restart
+}
+
+// Reloaded returns a copy of cur with the settings that can change at
+// runtime taken from next and the others left as they are.
+func Reloaded(cur, next *Config) *Config {
+	c := *cur
+	a := fields(reflect.ValueOf(&c).Elem(), "")
+	b := fields(reflect.ValueOf(next).Elem(), "")
+	for i := range a {
+		if a[i].reload {
+			a[i].value.Set(b[i].value)
+		}
+	}
+	return &c
+}
+
+var (
+	envMu sync.Mutex
+	// fromEnvFile marks the variables set from the env file rather than by
+	// the process environment, so that reloading picks up their new values
+	// while real variables keep taking precedence.
+	fromEnvFile = make(map[string]bool)
+)
+
+// loadEnvFile adds the variables of path to the environment without
+// replacing those set otherwise. Only the default file may be missing, in
+// which case it reports that nothing was loaded.
+func loadEnvFile(path string) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && path == defaultEnvFile {
+		return false, nil
+	}
+	vars, err := godotenv.Read(path)
+	if err != nil {
+		return false, fmt.Errorf("env file %s: %w", path, err)
+	}
+
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	for key := range fromEnvFile {
+		if _, ok := vars[key]; !ok {
+			os.Unsetenv(key)
+			delete(fromEnvFile, key)
+		}
+	}
+	for key, v := range vars {
+		if _, set := os.LookupEnv(key); set && !fromEnvFile[key] {
+			continue
+		}
+		os.Setenv(key, v)
+		fromEnvFile[key] = true
+	}
+	return true, nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setting is a single configuration value with its sources.
+type setting struct {
+	path   string
+	env    string
+	def    string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// fields lists the settings of the struct v, naming them by their YAML
+// path below prefix.
+func fields(v reflect.Value, prefix string) []setting {
+	var out []setting
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("yaml")
+		if name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		if f.Type.Kind() == reflect.Struct {
+			out = append(out, fields(v.Field(i), path+".")...)
+			continue
+		}
+		out = append(out, setting{
+			path:   path,
+			env:    f.Tag.Get("env"),
+			def:    f.Tag.Get("default"),
+			secret: f.Tag.Get("secret") == "true",
+			reload: f.Tag.Get("reload") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return out
+}
+
+// set parses raw into the setting according to its type.
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		s.value.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		s.value.SetBool(b)
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		s.value.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 10s or 1m30s", raw)
+		}
+		s.value.SetInt(int64(d))
+	case []string:
+		s.value.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		return fmt.Errorf("unsupported type %s", s.value.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping empty entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
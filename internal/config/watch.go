@@ -0,0 +1,48 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watch calls changed whenever one of files is modified, checking every
+// interval until ctx is done. Files that cannot be read are treated as
+// unchanged, so that one being replaced is picked up once it is back.
+func Watch(ctx context.Context, files []string, interval time.Duration, changed func()) {
+	stamps := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		stamps[f] = modTime(f)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		modified := false
+		for _, f := range files {
+			t := modTime(f)
+			if !t.IsZero() && !t.Equal(stamps[f]) {
+				stamps[f] = t
+				modified = true
+			}
+		}
+		if modified {
+			changed()
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"online-subscription/internal/handler/dto"
+	"online-subscription/internal/handler/helpers"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/usecase"
+
+	"go.uber.org/zap"
+)
+
+type APIKeyHandler struct {
+	uc *usecase.APIKeyUseCase
+}
+
+func NewAPIKeyHandler(uc *usecase.APIKeyUseCase) *APIKeyHandler {
+	return &APIKeyHandler{uc: uc}
+}
+
+// Create godoc
+// @Summary Create an API key
+// @Description Issue a non-expiring key for a service client. The key is returned only in this response
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param body body dto.CreateAPIKeyRequest true "Name and scopes (read, write, admin, summary)"
+// @Success 201 {object} dto.CreateAPIKeyResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /api-keys [post]
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req dto.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	k, plain, err := h.uc.Create(r.Context(), req.Name, req.Scopes)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("API key created",
+		zap.String("id", k.ID),
+		zap.String("name", k.Name),
+		zap.Strings("scopes", k.Scopes),
+	)
+
+	helpers.WriteJSON(w, http.StatusCreated, dto.CreateAPIKeyResponse{APIKey: k, Key: plain})
+}
+
+// List godoc
+// @Summary List API keys
+// @Description Get all API keys including revoked ones, without the keys themselves
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} model.APIKey
+// @Failure 403 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /api-keys [get]
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.uc.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, keys)
+}
+
+// Revoke godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key by ID. Requests with it are rejected from now on
+// @Tags api-keys
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request, id string) {
+	if err := h.uc.Revoke(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("API key revoked", zap.String("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
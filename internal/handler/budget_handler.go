@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"online-subscription/internal/handler/helpers"
+	"online-subscription/internal/handler/mapper"
+	"online-subscription/internal/handler/parser"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/usecase"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type BudgetHandler struct {
+	uc *usecase.BudgetUseCase
+}
+
+func NewBudgetHandler(uc *usecase.BudgetUseCase) *BudgetHandler {
+	return &BudgetHandler{uc: uc}
+}
+
+// Create godoc
+// @Summary Create a budget
+// @Description Set a spending limit for a user, optionally for a single service
+// @Tags budgets
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param budget body dto.CreateBudgetRequest true "Budget data"
+// @Success 201 {object} model.Budget
+// @Failure 400 {string} string
+// @Failure 409 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /users/{id}/budgets [post]
+func (h *BudgetHandler) Create(w http.ResponseWriter, r *http.Request, userID string) {
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "user id must be valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	req, err := parser.ParseCreateBudgetRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := mapper.BuildBudgetModel(userID, req)
+	if err := h.uc.Create(r.Context(), b); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			http.Error(w, "budget for this period and service already exists", http.StatusConflict)
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Budget created",
+		zap.String("id", b.ID),
+		zap.String("user_id", b.UserID),
+		zap.String("period", b.Period),
+	)
+
+	helpers.WriteJSON(w, http.StatusCreated, b)
+}
+
+// List godoc
+// @Summary List budgets
+// @Description Get all budgets of a user
+// @Tags budgets
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} model.Budget
+// @Failure 400 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /users/{id}/budgets [get]
+func (h *BudgetHandler) List(w http.ResponseWriter, r *http.Request, userID string) {
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "user id must be valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	budgets, err := h.uc.List(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, budgets)
+}
+
+// Delete godoc
+// @Summary Delete a budget
+// @Description Delete a budget of a user by ID
+// @Tags budgets
+// @Param id path string true "User ID"
+// @Param budget_id path string true "Budget ID"
+// @Success 204
+// @Failure 404 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /users/{id}/budgets/{budget_id} [delete]
+func (h *BudgetHandler) Delete(w http.ResponseWriter, r *http.Request, userID, id string) {
+	b, err := h.uc.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if b == nil || b.UserID != userID {
+		http.Error(w, "budget not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.uc.Delete(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Budget deleted", zap.String("id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Status godoc
+// @Summary Get budgets status
+// @Description Compare the user's spending with each budget for the current period
+// @Tags budgets
+// @Produce json
+// @Param id path string true "User ID"
+// @Param at query string false "Month inside the period in MM-YYYY, defaults to the current month"
+// @Success 200 {array} model.BudgetStatus
+// @Failure 400 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /users/{id}/budgets/status [get]
+func (h *BudgetHandler) Status(w http.ResponseWriter, r *http.Request, userID string) {
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "user id must be valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	at := time.Now()
+	if s := r.URL.Query().Get("at"); strings.TrimSpace(s) != "" {
+		t, err := helpers.ParseDateToTime(s)
+		if err != nil {
+			http.Error(w, "invalid at date", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	statuses, err := h.uc.Status(r.Context(), userID, at)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to calculate budget status", zap.Error(err))
+		writeError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, statuses)
+}
@@ -6,6 +6,8 @@ type CreateSubscriptionRequest struct {
 	StartDate   string  `json:"start_date"`
 	UserID      *string `json:"user_id,omitempty"`
 	EndDate     *string `json:"end_date"`
+	TrialEndsOn *string `json:"trial_ends_on,omitempty"`
+	IntroPrice  *int    `json:"intro_price,omitempty"`
 }
 
 type UpdateSubscriptionRequest struct {
@@ -13,4 +15,35 @@ type UpdateSubscriptionRequest struct {
 	Price       *int    `json:"monthly_price,omitempty"`
 	StartDate   *string `json:"start_date,omitempty"`
 	EndDate     *string `json:"end_date,omitempty"`
+	TrialEndsOn *string `json:"trial_ends_on,omitempty"`
+	IntroPrice  *int    `json:"intro_price,omitempty"`
+}
+
+type CreateBudgetRequest struct {
+	ServiceName *string `json:"service_name,omitempty"`
+	Period      string  `json:"period"`
+	Amount      int     `json:"amount"`
+}
+
+type PauseSubscriptionRequest struct {
+	From  *string `json:"from,omitempty"`
+	Until *string `json:"until,omitempty"`
+}
+
+type ResumeSubscriptionRequest struct {
+	From *string `json:"from,omitempty"`
+}
+
+type SaveMemberRequest struct {
+	SharePercent *int `json:"share_percent,omitempty"`
+	ShareAmount  *int `json:"share_amount,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type SetLogLevelRequest struct {
+	Level string `json:"level"`
 }
@@ -0,0 +1,20 @@
+package dto
+
+import "online-subscription/internal/model"
+
+// SubscriptionResponse is a subscription as returned by create and update,
+// with warnings about budgets the change pushed over their limit.
+type SubscriptionResponse struct {
+	*model.Subscription
+	Warnings []model.BudgetWarning `json:"Warnings,omitempty"`
+}
+
+// CreateAPIKeyResponse carries the plain key. It is shown only once.
+type CreateAPIKeyResponse struct {
+	*model.APIKey
+	Key string `json:"Key"`
+}
+
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/usecase"
+)
+
+// queryCanceled is the SQLSTATE Postgres reports for a statement canceled
+// on request or by statement_timeout.
+const queryCanceled = "57014"
+
+// writeError maps usecase errors to HTTP statuses. Anything unknown is a 500.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrForbidden),
+		errors.Is(err, rbac.ErrPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, usecase.ErrSubscriptionNotFound),
+		errors.Is(err, usecase.ErrNotMember),
+		errors.Is(err, usecase.ErrAPIKeyNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, usecase.ErrInvalidPause),
+		errors.Is(err, usecase.ErrInvalidShare),
+		errors.Is(err, usecase.ErrOwnerAsMember),
+		errors.Is(err, usecase.ErrInvalidBudget),
+		errors.Is(err, usecase.ErrInvalidScopes),
+		errors.Is(err, usecase.ErrInvalidLogLevel),
+		errors.Is(err, usecase.ErrInvalidChangeToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrAlreadyPaused),
+		errors.Is(err, usecase.ErrNotPaused),
+		errors.Is(err, usecase.ErrSharesExceed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, context.DeadlineExceeded), canceled(r, err):
+		http.Error(w, "request timed out", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// canceled reports whether err comes from the request being canceled. The
+// driver doesn't return the context error then: a query canceled mid-way
+// fails with Postgres' own "canceling statement" error.
+func canceled(r *http.Request, err error) bool {
+	if r.Context().Err() != nil {
+		return true
+	}
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == queryCanceled
+}
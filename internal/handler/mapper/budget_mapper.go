@@ -0,0 +1,20 @@
+package mapper
+
+import (
+	"online-subscription/internal/handler/dto"
+	"online-subscription/internal/model"
+)
+
+func BuildBudgetModel(userID string, req *dto.CreateBudgetRequest) *model.Budget {
+	var serviceName *string
+	if req.ServiceName != nil && *req.ServiceName != "" {
+		serviceName = req.ServiceName
+	}
+
+	return &model.Budget{
+		UserID:      userID,
+		ServiceName: serviceName,
+		Period:      req.Period,
+		Amount:      req.Amount,
+	}
+}
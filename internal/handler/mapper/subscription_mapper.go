@@ -29,6 +29,18 @@ func BuildSubscriptionModel(req *dto.CreateSubscriptionRequest) (*model.Subscrip
 		return nil, fmt.Errorf("end_date must be >= start_date")
 	}
 
+	var trialEndsOn *time.Time
+	if req.TrialEndsOn != nil && *req.TrialEndsOn != "" {
+		t, err := helpers.ParseDateToTime(*req.TrialEndsOn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trial_ends_on, expected MM-YYYY")
+		}
+		if t.Before(startDate) {
+			return nil, fmt.Errorf("trial_ends_on must be >= start_date")
+		}
+		trialEndsOn = &t
+	}
+
 	return &model.Subscription{
 		ID:          uuid.New().String(),
 		UserID:      *req.UserID,
@@ -36,5 +48,7 @@ func BuildSubscriptionModel(req *dto.CreateSubscriptionRequest) (*model.Subscrip
 		Price:       req.Price,
 		StartDate:   startDate,
 		EndDate:     endDate,
+		TrialEndsOn: trialEndsOn,
+		IntroPrice:  req.IntroPrice,
 	}, nil
 }
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"online-subscription/internal/handler/dto"
+	"online-subscription/internal/handler/helpers"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/model"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ListMembers godoc
+// @Summary List subscription members
+// @Description Get the users sharing the cost of a subscription besides its owner
+// @Tags members
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {array} model.Member
+// @Failure 404 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/{id}/members [get]
+func (h *SubscriptionHandler) ListMembers(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.ListMembers")
+	defer span.End()
+
+	members, err := h.uc.ListMembers(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, members)
+}
+
+// SaveMember godoc
+// @Summary Add or update a subscription member
+// @Description Share a subscription with a user for a percentage of the price or a fixed monthly amount. The owner pays the rest
+// @Tags members
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param user_id path string true "Member User ID"
+// @Param body body dto.SaveMemberRequest true "Share of the member"
+// @Success 200 {object} model.Member
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/{id}/members/{user_id} [put]
+func (h *SubscriptionHandler) SaveMember(w http.ResponseWriter, r *http.Request, id, userID string) {
+	r, span := startSpan(r, "SubscriptionHandler.SaveMember")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "user_id must be valid UUID", http.StatusBadRequest)
+		return
+	}
+
+	var req dto.SaveMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m := &model.Member{
+		SubscriptionID: id,
+		UserID:         userID,
+		SharePercent:   req.SharePercent,
+		ShareAmount:    req.ShareAmount,
+	}
+	if err := h.uc.SaveMember(r.Context(), m); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Subscription member saved",
+		zap.String("id", id),
+		zap.String("user_id", userID),
+	)
+
+	helpers.WriteJSON(w, http.StatusOK, m)
+}
+
+// RemoveMember godoc
+// @Summary Remove a subscription member
+// @Description Stop sharing a subscription with a user. Their share goes back to the owner
+// @Tags members
+// @Param id path string true "Subscription ID"
+// @Param user_id path string true "Member User ID"
+// @Success 204
+// @Failure 404 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/{id}/members/{user_id} [delete]
+func (h *SubscriptionHandler) RemoveMember(w http.ResponseWriter, r *http.Request, id, userID string) {
+	r, span := startSpan(r, "SubscriptionHandler.RemoveMember")
+	defer span.End()
+
+	if err := h.uc.RemoveMember(r.Context(), id, userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Subscription member removed",
+		zap.String("id", id),
+		zap.String("user_id", userID),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"online-subscription/internal/handler/dto"
+	"online-subscription/internal/model"
+)
+
+func ParseCreateBudgetRequest(r *http.Request) (*dto.CreateBudgetRequest, error) {
+	var req dto.CreateBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if req.Period != model.BudgetMonthly && req.Period != model.BudgetYearly {
+		return nil, fmt.Errorf("period must be %q or %q", model.BudgetMonthly, model.BudgetYearly)
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	return &req, nil
+}
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"online-subscription/internal/handler/dto"
 	"online-subscription/internal/handler/helpers"
@@ -33,5 +35,53 @@ func ParseCreateRequest(r *http.Request) (*dto.CreateSubscriptionRequest, error)
 		}
 	}
 
+	if req.TrialEndsOn != nil && *req.TrialEndsOn != "" {
+		if _, err := helpers.ParseDateToTime(*req.TrialEndsOn); err != nil {
+			return nil, fmt.Errorf("invalid trial_ends_on format, expected MM-YYYY")
+		}
+	}
+	if req.IntroPrice != nil && *req.IntroPrice < 0 {
+		return nil, fmt.Errorf("intro_price must not be negative")
+	}
+
+	return &req, nil
+}
+
+// ParsePauseRequest accepts an empty body, which pauses from the current
+// month until resumed.
+func ParsePauseRequest(r *http.Request) (*dto.PauseSubscriptionRequest, error) {
+	var req dto.PauseSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if req.From != nil && *req.From != "" {
+		if _, err := helpers.ParseDateToTime(*req.From); err != nil {
+			return nil, fmt.Errorf("invalid from format, expected MM-YYYY")
+		}
+	}
+	if req.Until != nil && *req.Until != "" {
+		if _, err := helpers.ParseDateToTime(*req.Until); err != nil {
+			return nil, fmt.Errorf("invalid until format, expected MM-YYYY")
+		}
+	}
+
+	return &req, nil
+}
+
+// ParseResumeRequest accepts an empty body, which resumes from the current
+// month.
+func ParseResumeRequest(r *http.Request) (*dto.ResumeSubscriptionRequest, error) {
+	var req dto.ResumeSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if req.From != nil && *req.From != "" {
+		if _, err := helpers.ParseDateToTime(*req.From); err != nil {
+			return nil, fmt.Errorf("invalid from format, expected MM-YYYY")
+		}
+	}
+
 	return &req, nil
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"online-subscription/internal/handler/dto"
+	"online-subscription/internal/handler/helpers"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/usecase"
+
+	"go.uber.org/zap"
+)
+
+type SettingsHandler struct {
+	uc *usecase.SettingsUseCase
+}
+
+func NewSettingsHandler(uc *usecase.SettingsUseCase) *SettingsHandler {
+	return &SettingsHandler{uc: uc}
+}
+
+// LogLevel godoc
+// @Summary Get the log level
+// @Description Get the current minimum log level of the service
+// @Tags admin
+// @Produce json
+// @Success 200 {object} dto.LogLevelResponse
+// @Failure 403 {string} string
+// @Security BearerAuth
+// @Router /admin/log-level [get]
+func (h *SettingsHandler) LogLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := h.uc.LogLevel(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, dto.LogLevelResponse{Level: level})
+}
+
+// SetLogLevel godoc
+// @Summary Change the log level
+// @Description Change the minimum log level without a restart. It holds until the next restart or configuration reload changing log.level
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body dto.SetLogLevelRequest true "DEBUG, INFO, WARN or ERROR"
+// @Success 200 {object} dto.LogLevelResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Security BearerAuth
+// @Router /admin/log-level [put]
+func (h *SettingsHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req dto.SetLogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	previous := logger.Level()
+	if err := h.uc.SetLogLevel(r.Context(), req.Level); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Warn("Log level changed",
+		zap.String("from", previous),
+		zap.String("to", logger.Level()),
+	)
+
+	helpers.WriteJSON(w, http.StatusOK, dto.LogLevelResponse{Level: logger.Level()})
+}
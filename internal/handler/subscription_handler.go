@@ -2,6 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"online-subscription/internal/handler/dto"
 	"online-subscription/internal/handler/helpers"
@@ -12,17 +15,30 @@ import (
 	"online-subscription/internal/usecase"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type SubscriptionHandler struct {
-	uc *usecase.SubscriptionUseCase
+	uc      *usecase.SubscriptionUseCase
+	budgets *usecase.BudgetUseCase
+
+	// streamsDone is closed on shutdown to end open change streams, which
+	// would otherwise keep the server from stopping.
+	streamsDone chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewSubscriptionHandler(uc *usecase.SubscriptionUseCase, budgets *usecase.BudgetUseCase) *SubscriptionHandler {
+	return &SubscriptionHandler{uc: uc, budgets: budgets, streamsDone: make(chan struct{})}
 }
 
-func NewSubscriptionHandler(uc *usecase.SubscriptionUseCase) *SubscriptionHandler {
-	return &SubscriptionHandler{uc: uc}
+// CloseStreams ends the open change streams; clients reconnect with the
+// last event ID they got.
+func (h *SubscriptionHandler) CloseStreams() {
+	h.closeOnce.Do(func() { close(h.streamsDone) })
 }
 
 // Create godoc
@@ -32,11 +48,15 @@ func NewSubscriptionHandler(uc *usecase.SubscriptionUseCase) *SubscriptionHandle
 // @Accept json
 // @Produce json
 // @Param subscription body dto.CreateSubscriptionRequest true "Subscription data"
-// @Success 201 {object} model.Subscription
+// @Success 201 {object} dto.SubscriptionResponse
 // @Failure 400 {string} string
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions [post]
 func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "SubscriptionHandler.Create")
+	defer span.End()
+
 	req, err := parser.ParseCreateRequest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -50,17 +70,17 @@ func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.uc.Create(r.Context(), sub); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	logger.Info("Subscription created",
+	logger.FromContext(r.Context()).Info("Subscription created",
 		zap.String("id", sub.ID),
 		zap.String("service", sub.ServiceName),
 		zap.String("user_id", sub.UserID),
 	)
 
-	helpers.WriteJSON(w, http.StatusCreated, sub)
+	helpers.WriteJSON(w, http.StatusCreated, h.withWarnings(r, sub))
 }
 
 // List godoc
@@ -71,10 +91,18 @@ func (h *SubscriptionHandler) Create(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param user_id query string false "Filter by User ID"
 // @Param service_name query string false "Filter by Service Name"
+// @Param created_since query string false "Only subscriptions created at or after this RFC 3339 time"
+// @Param updated_since query string false "Only subscriptions updated at or after this RFC 3339 time"
+// @Param sort query string false "start_date, created_at or updated_at, descending with a leading '-'; -start_date by default"
 // @Success 200 {array} model.Subscription
+// @Failure 400 {string} string
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions [get]
 func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "SubscriptionHandler.List")
+	defer span.End()
+
 	q := r.URL.Query()
 
 	f := model.SubscriptionFilter{
@@ -82,6 +110,31 @@ func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
 		ServiceName: helpers.PtrString(q.Get("service_name")),
 	}
 
+	for param, dst := range map[string]**time.Time{
+		"created_since": &f.CreatedSince,
+		"updated_since": &f.UpdatedSince,
+	} {
+		if v := q.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				http.Error(w, "invalid "+param+", expected RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*dst = &t
+		}
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		f.OrderBy = strings.TrimPrefix(sort, "-")
+		f.Desc = strings.HasPrefix(sort, "-")
+		switch f.OrderBy {
+		case model.SortByStartDate, model.SortByCreatedAt, model.SortByUpdatedAt:
+		default:
+			http.Error(w, "invalid sort, expected start_date, created_at or updated_at", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// parse limit
 	if limitStr := q.Get("limit"); limitStr != "" {
 		limit, err := strconv.Atoi(limitStr)
@@ -103,17 +156,196 @@ func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	subs, err := h.uc.List(r.Context(), &f)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	logger.Info("Subscriptions listed",
+	logger.FromContext(r.Context()).Info("Subscriptions listed",
 		zap.Int("count", len(subs)),
 	)
 
 	helpers.WriteJSON(w, http.StatusOK, subs)
 }
 
+// Changes godoc
+// @Summary Subscription changes
+// @Description Subscriptions created, updated or deleted since the position of a previous response, for incremental sync. Pass its Next as since; request again right away while HasMore is set.
+// @Tags subscriptions
+// @Produce json
+// @Param since query string false "Next of the previous response, empty to start from the beginning"
+// @Param limit query int false "Changes per response, 100 by default and at most 1000"
+// @Param user_id query string false "Filter by owner; a subscription handed over to another owner comes as deleted"
+// @Success 200 {object} model.ChangeFeed
+// @Failure 400 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/changes [get]
+func (h *SubscriptionHandler) Changes(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "SubscriptionHandler.Changes")
+	defer span.End()
+
+	q := r.URL.Query()
+
+	var limit int
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	feed, err := h.uc.Changes(r.Context(), helpers.PtrString(q.Get("user_id")), q.Get("since"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Subscription changes listed",
+		zap.Int("count", len(feed.Changes)),
+		zap.Bool("has_more", feed.HasMore),
+	)
+
+	helpers.WriteJSON(w, http.StatusOK, feed)
+}
+
+const (
+	// streamHeartbeat is how often an idle stream sends a comment, which
+	// keeps proxies from closing it, and looks for changes it was not woken
+	// up for.
+	streamHeartbeat = 15 * time.Second
+	// streamRetry is how long clients wait before reconnecting.
+	streamRetry = 3 * time.Second
+)
+
+// Stream godoc
+// @Summary Stream subscription changes
+// @Description Server-Sent Events with the changes of the change feed as they happen. Events are named created, updated or deleted and carry the same data as the feed entries. Reconnecting with Last-Event-ID resumes after the last event received; without it and since, the stream starts with the changes made after connecting.
+// @Tags subscriptions
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Param since query string false "Next of a change feed response to start from"
+// @Param user_id query string false "Filter by owner; a subscription handed over to another owner comes as deleted"
+// @Success 200 {string} string "event stream"
+// @Failure 400 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/stream [get]
+func (h *SubscriptionHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "SubscriptionHandler.Stream")
+	defer span.End()
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	userID := helpers.PtrString(q.Get("user_id"))
+
+	token := r.Header.Get("Last-Event-ID")
+	if token == "" {
+		token = q.Get("since")
+	}
+	if token == "" {
+		var err error
+		if token, err = h.uc.ChangesHead(ctx); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	// Watch before the first read so that no change falls in between.
+	wake, stop := h.uc.WatchChanges(ctx)
+	defer stop()
+
+	feed, err := h.uc.Changes(ctx, userID, token, usecase.MaxChanges)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout is meant for ordinary responses.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		logger.FromContext(ctx).Warn("Failed to lift write deadline for change stream", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	logger.FromContext(ctx).Info("Subscription change stream opened")
+	defer logger.FromContext(ctx).Info("Subscription change stream closed")
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		if err := writeChangeEvents(w, feed, token); err != nil {
+			return
+		}
+		token = feed.Next
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		if !feed.HasMore {
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.streamsDone:
+				return
+			case <-wake:
+			case <-heartbeat.C:
+				if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			}
+		}
+
+		if feed, err = h.uc.Changes(ctx, userID, token, usecase.MaxChanges); err != nil {
+			if ctx.Err() == nil {
+				logger.FromContext(ctx).Error("Failed to read subscription changes for stream", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// writeChangeEvents writes a feed as events whose IDs resume the stream
+// after them. When the feed moved past its last change, or has none, the
+// new position is sent as a bare ID so that a reconnecting client does not
+// read the same range again.
+func writeChangeEvents(w io.Writer, feed *model.ChangeFeed, token string) error {
+	for _, c := range feed.Changes {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", c.Token, changeEvent(c), data); err != nil {
+			return err
+		}
+		token = c.Token
+	}
+	if feed.Next != token {
+		if _, err := fmt.Fprintf(w, "id: %s\n\n", feed.Next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func changeEvent(c *model.SubscriptionChange) string {
+	switch {
+	case c.Deleted:
+		return "deleted"
+	case c.Subscription.CreatedAt.Equal(c.Subscription.UpdatedAt):
+		return "created"
+	default:
+		return "updated"
+	}
+}
+
 // GetById godoc
 // @Summary Get subscription by ID
 // @Description Returns a subscription by its ID
@@ -123,11 +355,15 @@ func (h *SubscriptionHandler) List(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} model.Subscription
 // @Failure 404 {string} string
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions/{id} [get]
 func (h *SubscriptionHandler) GetById(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.GetById")
+	defer span.End()
+
 	s, err := h.uc.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	if s == nil {
@@ -135,7 +371,7 @@ func (h *SubscriptionHandler) GetById(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
-	logger.Info("Subscription retrieved", zap.String("id", s.ID))
+	logger.FromContext(r.Context()).Info("Subscription retrieved", zap.String("id", s.ID))
 	helpers.WriteJSON(w, http.StatusOK, s)
 }
 
@@ -147,12 +383,17 @@ func (h *SubscriptionHandler) GetById(w http.ResponseWriter, r *http.Request, id
 // @Produce json
 // @Param id path string true "Subscription ID"
 // @Param body body dto.UpdateSubscriptionRequest true "Fields to update"
-// @Success 200 {object} model.Subscription
+// @Success 200 {object} dto.SubscriptionResponse
 // @Failure 400 {string} string
 // @Failure 404 {string} string
+// @Failure 409 {string} string
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions/{id} [patch]
 func (h *SubscriptionHandler) Update(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.Update")
+	defer span.End()
+
 	if r.Method != http.MethodPatch && r.Method != http.MethodPut {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -166,7 +407,7 @@ func (h *SubscriptionHandler) Update(w http.ResponseWriter, r *http.Request, id
 
 	sub, err := h.uc.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	if sub == nil {
@@ -198,20 +439,43 @@ func (h *SubscriptionHandler) Update(w http.ResponseWriter, r *http.Request, id
 	} else {
 		sub.EndDate = nil
 	}
+	if req.TrialEndsOn != nil {
+		if *req.TrialEndsOn == "" {
+			sub.TrialEndsOn = nil
+		} else {
+			trial, err := helpers.ParseDateToTime(*req.TrialEndsOn)
+			if err != nil {
+				http.Error(w, "invalid trial_ends_on format", http.StatusBadRequest)
+				return
+			}
+			sub.TrialEndsOn = &trial
+		}
+	}
+	if req.IntroPrice != nil {
+		if *req.IntroPrice < 0 {
+			http.Error(w, "intro_price must not be negative", http.StatusBadRequest)
+			return
+		}
+		sub.IntroPrice = req.IntroPrice
+	}
+	if sub.TrialEndsOn != nil && sub.TrialEndsOn.Before(sub.StartDate) {
+		http.Error(w, "trial_ends_on must be >= start_date", http.StatusBadRequest)
+		return
+	}
 
 	if err := h.uc.Update(r.Context(), sub); err != nil {
-		logger.Error("Failed to update subscription", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("Failed to update subscription", zap.Error(err))
+		writeError(w, r, err)
 		return
 	}
 
-	logger.Info("Subscription updated",
+	logger.FromContext(r.Context()).Info("Subscription updated",
 		zap.String("id", sub.ID),
 		zap.String("service", sub.ServiceName),
 		zap.String("user_id", sub.UserID),
 	)
 
-	helpers.WriteJSON(w, http.StatusOK, sub)
+	helpers.WriteJSON(w, http.StatusOK, h.withWarnings(r, sub))
 }
 
 // Delete godoc
@@ -221,31 +485,147 @@ func (h *SubscriptionHandler) Update(w http.ResponseWriter, r *http.Request, id
 // @Param id path string true "Subscription ID"
 // @Success 204
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions/{id} [delete]
 func (h *SubscriptionHandler) Delete(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.Delete")
+	defer span.End()
+
 	if err := h.uc.Delete(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	logger.Info("Subscription deleted", zap.String("id", id))
+	logger.FromContext(r.Context()).Info("Subscription deleted", zap.String("id", id))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Pause godoc
+// @Summary Pause subscription
+// @Description Stop billing a subscription for a range of months. Without a body it is paused from the current month until resumed
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param body body dto.PauseSubscriptionRequest false "Months to pause in MM-YYYY"
+// @Success 201 {object} model.Pause
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/{id}/pause [post]
+func (h *SubscriptionHandler) Pause(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.Pause")
+	defer span.End()
+
+	req, err := parser.ParsePauseRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var from, until *time.Time
+	if req.From != nil && *req.From != "" {
+		t, err := helpers.ParseDateToTime(*req.From)
+		if err != nil {
+			http.Error(w, "invalid from format", http.StatusBadRequest)
+			return
+		}
+		from = &t
+	}
+	if req.Until != nil && *req.Until != "" {
+		t, err := helpers.ParseDateToTime(*req.Until)
+		if err != nil {
+			http.Error(w, "invalid until format", http.StatusBadRequest)
+			return
+		}
+		until = &t
+	}
+
+	p, err := h.uc.Pause(r.Context(), id, from, until)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Subscription paused",
+		zap.String("id", id),
+		zap.String("from", p.StartMonth.Format("01-2006")),
+	)
+
+	helpers.WriteJSON(w, http.StatusCreated, p)
+}
+
+// Resume godoc
+// @Summary Resume subscription
+// @Description End the pause of a subscription so that it is billed again from the given month (current month by default)
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param body body dto.ResumeSubscriptionRequest false "Month to resume from in MM-YYYY"
+// @Success 200 {object} model.Pause
+// @Success 204
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Failure 500 {string} string
+// @Security BearerAuth
+// @Router /subscriptions/{id}/resume [post]
+func (h *SubscriptionHandler) Resume(w http.ResponseWriter, r *http.Request, id string) {
+	r, span := startSpan(r, "SubscriptionHandler.Resume")
+	defer span.End()
+
+	req, err := parser.ParseResumeRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var at *time.Time
+	if req.From != nil && *req.From != "" {
+		t, err := helpers.ParseDateToTime(*req.From)
+		if err != nil {
+			http.Error(w, "invalid from format", http.StatusBadRequest)
+			return
+		}
+		at = &t
+	}
+
+	p, err := h.uc.Resume(r.Context(), id, at)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger.FromContext(r.Context()).Info("Subscription resumed", zap.String("id", id))
+
+	if p == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	helpers.WriteJSON(w, http.StatusOK, p)
+}
+
 // Summary godoc
 // @Summary Get subscriptions summary
 // @Description Calculate total subscription cost for a period with optional filters
 // @Tags subscriptions
 // @Produce json
 // @Param from query string true "Start date in MM-YYYY"
-// @Param to query string false "End date in MM-YYYY"
+// @Param to query string false "End date in MM-YYYY, the current month when omitted (since API 1.1)"
 // @Param user_id query string false "Filter by User ID"
 // @Param service_name query string false "Filter by Service Name"
 // @Success 200 {object} map[string]int
 // @Failure 400 {string} string
 // @Failure 500 {string} string
+// @Security BearerAuth
 // @Router /subscriptions/summary [get]
 func (h *SubscriptionHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "SubscriptionHandler.Summary")
+	defer span.End()
+
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -283,12 +663,12 @@ func (h *SubscriptionHandler) Summary(w http.ResponseWriter, r *http.Request) {
 
 	sum, err := h.uc.Sum(r.Context(), &f)
 	if err != nil {
-		logger.Error("Failed to calculate summary", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("Failed to calculate summary", zap.Error(err))
+		writeError(w, r, err)
 		return
 	}
 
-	logger.Info("Summary calculated",
+	logger.FromContext(r.Context()).Info("Summary calculated",
 		zap.Int("sum", sum),
 		zap.String("user_id", helpers.SafeString(f.UserID)),
 		zap.String("service_name", helpers.SafeString(f.ServiceName)),
@@ -303,3 +683,27 @@ func (h *SubscriptionHandler) Summary(w http.ResponseWriter, r *http.Request) {
 
 	helpers.WriteJSON(w, http.StatusOK, map[string]int{"total": sum})
 }
+
+// withWarnings evaluates the user's budgets after a write. A failed check
+// must not fail the write itself, so it is only logged.
+func (h *SubscriptionHandler) withWarnings(r *http.Request, sub *model.Subscription) dto.SubscriptionResponse {
+	resp := dto.SubscriptionResponse{Subscription: sub}
+
+	warnings, err := h.budgets.Evaluate(r.Context(), sub)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to evaluate budgets", zap.String("id", sub.ID), zap.Error(err))
+		return resp
+	}
+
+	for _, wr := range warnings {
+		logger.FromContext(r.Context()).Info("Budget exceeded",
+			zap.String("budget_id", wr.BudgetID),
+			zap.String("user_id", sub.UserID),
+			zap.Int("amount", wr.Amount),
+			zap.Int("spent", wr.Spent),
+		)
+	}
+
+	resp.Warnings = warnings
+	return resp
+}
@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+	"online-subscription/internal/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan opens the span of a handler and returns the request carrying
+// it, so that the spans of the usecase nest under it. Failed requests are
+// marked on the server span by the HTTP middleware.
+func startSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx, span := tracing.Start(r.Context(), name)
+	return r.WithContext(ctx), span
+}
@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// fieldSet holds the fields of one request. It is shared by everything
+// handling the request, so fields added deep inside, such as the user, also
+// reach entries written by outer middleware like the access log.
+type fieldSet struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+type fieldsKey struct{}
+
+type loggerKey struct{}
+
+// WithLogger makes l the logger FromContext builds on for ctx and the
+// contexts derived from it, in place of the global one.
+func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// NewContext starts a field set for a request or job. Fields already in ctx
+// are carried over.
+func NewContext(ctx context.Context, fields ...zap.Field) context.Context {
+	set := &fieldSet{fields: append(contextFields(ctx), fields...)}
+	return context.WithValue(ctx, fieldsKey{}, set)
+}
+
+// AddFields attaches fields to every later entry logged through ctx. It
+// does nothing when ctx has no field set.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	set, ok := ctx.Value(fieldsKey{}).(*fieldSet)
+	if !ok {
+		return
+	}
+
+	set.mu.Lock()
+	set.fields = append(set.fields, fields...)
+	set.mu.Unlock()
+}
+
+// FromContext returns the logger of ctx, or the global one, enriched with
+// the fields of ctx, such as the request ID, route and user. It never
+// returns nil.
+func FromContext(ctx context.Context) *zap.Logger {
+	l, ok := ctx.Value(loggerKey{}).(*zap.Logger)
+	if !ok {
+		l = log
+	}
+	if l == nil {
+		return zap.NewNop()
+	}
+	if fields := contextFields(ctx); len(fields) > 0 {
+		return l.With(fields...)
+	}
+	return l
+}
+
+func contextFields(ctx context.Context) []zap.Field {
+	set, ok := ctx.Value(fieldsKey{}).(*fieldSet)
+	if !ok {
+		return nil
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return append([]zap.Field(nil), set.fields...)
+}
@@ -1,47 +1,123 @@
 package logger
 
 import (
+	"fmt"
 	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var log *zap.Logger
+var (
+	log *zap.Logger
+	// helperLog backs the package-level functions and skips them when
+	// reporting the caller.
+	helperLog *zap.Logger
+	level     = zap.NewAtomicLevel()
+)
+
+// Options configure a logger built by Init or New.
+type Options struct {
+	Level string
+	// Format is "console" for human-readable output or "json" for log
+	// collectors.
+	Format string
+	// Sampling keeps the first 100 entries with the same message per second
+	// and every 100th after that.
+	Sampling bool
+	// RedactFields are field keys masked in addition to DefaultRedactFields.
+	RedactFields []string
+}
+
+// Init builds the global logger, used by the package-level functions and
+// by FromContext when the context carries no logger of its own.
+func Init(opts Options) error {
+	l, err := New(opts)
+	if err != nil {
+		return err
+	}
+
+	log = l
+	helperLog = l.WithOptions(zap.AddCallerSkip(1))
+	return nil
+}
 
-func Init(level string) error {
-	var zapLevel zapcore.Level
+// New builds a logger without making it global. Its minimum level is the
+// shared one that SetLevel changes.
+func New(opts Options) (*zap.Logger, error) {
+	level.SetLevel(parseLevel(opts.Level))
+
+	var cfg zap.Config
+	if strings.EqualFold(opts.Format, "json") {
+		cfg = zap.NewProductionConfig()
+		cfg.EncoderConfig.TimeKey = "time"
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	} else {
+		cfg = zap.NewDevelopmentConfig()
+	}
+	cfg.Level = level
+	cfg.Sampling = nil
+	if opts.Sampling {
+		cfg.Sampling = &zap.SamplingConfig{Initial: 100, Thereafter: 100}
+	}
+
+	redacted := redactSet(opts.RedactFields)
+	return cfg.Build(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return &redactCore{Core: c, keys: redacted}
+	}))
+}
+
+// Level returns the current minimum level, such as "info".
+func Level() string {
+	return level.Level().String()
+}
 
-	switch strings.ToUpper(level) {
+// SetLevel changes the minimum level of every logger at runtime. It accepts
+// DEBUG, INFO, WARN and ERROR in any case.
+func SetLevel(s string) error {
+	switch strings.ToUpper(s) {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		level.SetLevel(parseLevel(s))
+		return nil
+	default:
+		return fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+func parseLevel(s string) zapcore.Level {
+	switch strings.ToUpper(s) {
 	case "DEBUG":
-		zapLevel = zapcore.DebugLevel
-	case "INFO":
-		zapLevel = zapcore.InfoLevel
+		return zapcore.DebugLevel
 	case "WARN":
-		zapLevel = zapcore.WarnLevel
+		return zapcore.WarnLevel
 	case "ERROR":
-		zapLevel = zapcore.ErrorLevel
+		return zapcore.ErrorLevel
 	default:
-		zapLevel = zapcore.InfoLevel
+		return zapcore.InfoLevel
 	}
+}
 
-	cfg := zap.NewDevelopmentConfig()
-	cfg.Level = zap.NewAtomicLevelAt(zapLevel)
-
-	var err error
-	log, err = cfg.Build()
-	return err
+func Debug(msg string, args ...zap.Field) {
+	if helperLog != nil {
+		helperLog.Debug(msg, args...)
+	}
 }
 
 func Info(msg string, args ...zap.Field) {
-	if log != nil {
-		log.Info(msg, args...)
+	if helperLog != nil {
+		helperLog.Info(msg, args...)
+	}
+}
+
+func Warn(msg string, args ...zap.Field) {
+	if helperLog != nil {
+		helperLog.Warn(msg, args...)
 	}
 }
 
 func Error(msg string, args ...zap.Field) {
-	if log != nil {
-		log.Error(msg, args...)
+	if helperLog != nil {
+		helperLog.Error(msg, args...)
 	}
 }
 
@@ -56,7 +132,7 @@ func Sync() {
 }
 
 func Fatal(msg string, args ...zap.Field) {
-	if log != nil {
-		log.Fatal(msg, args...)
+	if helperLog != nil {
+		helperLog.Fatal(msg, args...)
 	}
 }
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultRedactFields are field keys whose values never reach the log.
+// Keys are compared case-insensitively.
+var DefaultRedactFields = []string{
+	"password", "secret", "token", "authorization", "api_key", "key", "key_hash", "dsn",
+}
+
+const redacted = "[REDACTED]"
+
+func redactSet(extra []string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, k := range append(DefaultRedactFields, extra...) {
+		if k = strings.TrimSpace(k); k != "" {
+			keys[strings.ToLower(k)] = true
+		}
+	}
+	return keys
+}
+
+// redactCore masks sensitive fields before they are encoded.
+type redactCore struct {
+	zapcore.Core
+	keys map[string]bool
+}
+
+func (c *redactCore) With(fields []zap.Field) zapcore.Core {
+	return &redactCore{Core: c.Core.With(c.redact(fields)), keys: c.keys}
+}
+
+// Check asks the wrapped core, which may sample, but registers the wrapper
+// so that Write still goes through redaction.
+func (c *redactCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Core.Check(e, nil) != nil {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(e zapcore.Entry, fields []zap.Field) error {
+	return c.Core.Write(e, c.redact(fields))
+}
+
+func (c *redactCore) redact(fields []zap.Field) []zap.Field {
+	var out []zap.Field
+	for i, f := range fields {
+		if !c.keys[strings.ToLower(f.Key)] {
+			continue
+		}
+		if out == nil {
+			out = append([]zap.Field(nil), fields...)
+		}
+		out[i] = zap.String(f.Key, redacted)
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
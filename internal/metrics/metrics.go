@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"online-subscription/internal/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "online_subscription"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Duration of repository calls by repository and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repository", "method"})
+)
+
+// NewRegistry returns a registry for one instance of the service, holding
+// the Go runtime and process collectors and the request and query metrics.
+// Those are recorded process-wide; the database and business metrics
+// registered later are the instance's own.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		queryDuration,
+	)
+	return reg
+}
+
+// Handler serves the metrics of reg in the Prometheus text format. A
+// collector that fails, such as the business one while the database is
+// down, leaves out its own metrics rather than the whole scrape.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		Registry:      reg,
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// ObserveHTTP records a served request. route must be a template such as
+// "/subscriptions/{id}" to keep the number of series bounded.
+func ObserveHTTP(route, method string, status int, d time.Duration) {
+	s := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, s).Inc()
+	httpDuration.WithLabelValues(route, method, s).Observe(d.Seconds())
+}
+
+// ObserveQuery records a repository call that started at start. It is meant
+// to be deferred: defer metrics.ObserveQuery("subscriptions", "List", time.Now()).
+func ObserveQuery(repository, method string, start time.Time) {
+	queryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDB exports the connection pool stats of db through reg.
+func RegisterDB(reg prometheus.Registerer, db *sql.DB, name string) error {
+	return reg.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+type StatsSource interface {
+	TenantStats(ctx context.Context, month time.Time) ([]*model.TenantStats, error)
+}
+
+// RegisterBusiness exports per-tenant business gauges computed by src
+// through reg, logging failed queries to log. The query aggregates every
+// tenant, so its result is reused for businessMaxAge rather than run on
+// every scrape.
+func RegisterBusiness(reg prometheus.Registerer, src StatsSource, log *zap.Logger) error {
+	return reg.Register(&businessCollector{src: src, log: log})
+}
+
+var (
+	activeSubscriptionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "active_subscriptions"),
+		"Active subscriptions that have started, by tenant.",
+		[]string{"tenant"}, nil,
+	)
+	monthlySpendDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "current_monthly_spend"),
+		"Spend of the current month across all users, by tenant.",
+		[]string{"tenant"}, nil,
+	)
+)
+
+const (
+	// scrapeTimeout bounds the queries of one scrape so a slow database
+	// can't pile scrapes up.
+	scrapeTimeout = 5 * time.Second
+	// businessMaxAge is how long computed business gauges are served
+	// before they are computed again.
+	businessMaxAge = time.Minute
+)
+
+type businessCollector struct {
+	src StatsSource
+	log *zap.Logger
+
+	// mu is held while the stats are computed, so scrapes that come in
+	// meanwhile wait for the result instead of querying too.
+	mu       sync.Mutex
+	stats    []*model.TenantStats
+	computed time.Time
+}
+
+func (c *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSubscriptionsDesc
+	ch <- monthlySpendDesc
+}
+
+func (c *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.load()
+	if err != nil {
+		c.log.Error("Failed to collect business metrics", zap.Error(err))
+		ch <- prometheus.NewInvalidMetric(activeSubscriptionsDesc, err)
+		return
+	}
+
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(activeSubscriptionsDesc, prometheus.GaugeValue,
+			float64(s.ActiveSubscriptions), s.TenantID)
+		ch <- prometheus.MustNewConstMetric(monthlySpendDesc, prometheus.GaugeValue,
+			float64(s.MonthlySpend), s.TenantID)
+	}
+}
+
+// load returns the stats computed within businessMaxAge, computing them
+// again when they are older.
+func (c *businessCollector) load() ([]*model.TenantStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.computed.IsZero() && now.Sub(c.computed) < businessMaxAge {
+		return c.stats, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	stats, err := c.src.TenantStats(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+	c.stats, c.computed = stats, now
+	return stats, nil
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	ScopeRead    = "read"
+	ScopeWrite   = "write"
+	ScopeAdmin   = "admin"
+	ScopeSummary = "summary"
+)
+
+// APIKey is a non-expiring credential for service-to-service clients. Only
+// a hash of the key is stored; Prefix is kept to tell keys apart.
+type APIKey struct {
+	ID         string     `db:"id"`
+	TenantID   string     `db:"tenant_id" json:"-"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash" json:"-"`
+	Scopes     []string   `db:"-"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
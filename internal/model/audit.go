@@ -0,0 +1,12 @@
+package model
+
+type AuditEntry struct {
+	TenantID string
+	UserID   string
+	APIKeyID string
+	Roles    []string
+	Action   string
+	Resource string
+	Allowed  bool
+	Reason   string
+}
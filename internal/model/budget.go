@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+const (
+	BudgetMonthly = "monthly"
+	BudgetYearly  = "yearly"
+)
+
+// Budget caps what a user spends on subscriptions per period. A nil
+// ServiceName applies the limit to all of the user's subscriptions.
+type Budget struct {
+	ID          string  `db:"id"`
+	TenantID    string  `db:"tenant_id" json:"-"`
+	UserID      string  `db:"user_id"`
+	ServiceName *string `db:"service_name"`
+	Period      string  `db:"period"`
+	Amount      int     `db:"amount"`
+}
+
+type BudgetStatus struct {
+	Budget    *Budget
+	From      time.Time
+	To        time.Time
+	Spent     int
+	Remaining int
+	Exceeded  bool
+}
+
+type BudgetWarning struct {
+	BudgetID    string
+	ServiceName *string
+	Period      string
+	Amount      int
+	Spent       int
+	Message     string
+}
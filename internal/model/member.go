@@ -0,0 +1,13 @@
+package model
+
+// Member shares the cost of a subscription owned by another user. Exactly
+// one of SharePercent and ShareAmount is set. ShareAmount is the member's
+// part of the regular monthly price; during a trial it shrinks in the same
+// proportion as the price. The owner pays whatever the members don't.
+type Member struct {
+	SubscriptionID string `db:"subscription_id"`
+	TenantID       string `db:"tenant_id" json:"-"`
+	UserID         string `db:"user_id"`
+	SharePercent   *int   `db:"share_percent"`
+	ShareAmount    *int   `db:"share_amount"`
+}
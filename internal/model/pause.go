@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Pause is a run of months a subscription is not billed for, both ends
+// inclusive. A nil EndMonth means the subscription stays paused until it is
+// resumed.
+type Pause struct {
+	ID             string     `db:"id"`
+	SubscriptionID string     `db:"subscription_id"`
+	TenantID       string     `db:"tenant_id" json:"-"`
+	StartMonth     time.Time  `db:"start_month"`
+	EndMonth       *time.Time `db:"end_month"`
+}
+
+// Covers reports whether month falls inside the pause.
+func (p *Pause) Covers(month time.Time) bool {
+	return !month.Before(p.StartMonth) && (p.EndMonth == nil || !month.After(*p.EndMonth))
+}
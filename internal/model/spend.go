@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// SpendMismatch is a month where the materialized monthly_spend amount
+// disagrees with the amount computed from subscriptions.
+type SpendMismatch struct {
+	TenantID    string    `db:"tenant_id"`
+	UserID      string    `db:"user_id"`
+	ServiceName string    `db:"service_name"`
+	Month       time.Time `db:"month"`
+	Stored      int       `db:"stored"`
+	Live        int       `db:"live"`
+}
+
+// TenantStats is a snapshot of one tenant for monitoring.
+type TenantStats struct {
+	TenantID            string `db:"tenant_id"`
+	ActiveSubscriptions int    `db:"active_subscriptions"`
+	MonthlySpend        int    `db:"monthly_spend"`
+}
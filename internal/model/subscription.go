@@ -2,13 +2,41 @@ package model
 
 import "time"
 
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+)
+
 type Subscription struct {
 	ID          string     `db:"id"`
+	TenantID    string     `db:"tenant_id" json:"-"`
 	ServiceName string     `db:"service_name"`
 	Price       int        `db:"monthly_price"`
 	UserID      string     `db:"user_id"`
 	StartDate   time.Time  `db:"start_date"`
 	EndDate     *time.Time `db:"end_date"`
+	Status      string     `db:"status"`
+	// TrialEndsOn is the last month charged at IntroPrice. A trial without
+	// an intro price is free.
+	TrialEndsOn *time.Time `db:"trial_ends_on"`
+	IntroPrice  *int       `db:"intro_price"`
+	CreatedAt   time.Time  `db:"created_at"`
+	// UpdatedAt changes with every write to the subscription, including
+	// expiry by the background job.
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// PriceFor returns the amount charged for the given month, taking the trial
+// into account. It does not check that the month lies within the
+// subscription.
+func (s *Subscription) PriceFor(month time.Time) int {
+	if s.TrialEndsOn != nil && !month.After(*s.TrialEndsOn) {
+		if s.IntroPrice != nil {
+			return *s.IntroPrice
+		}
+		return 0
+	}
+	return s.Price
 }
 
 type SubscriptionFilter struct {
@@ -16,13 +44,66 @@ type SubscriptionFilter struct {
 	ServiceName *string
 	FromDate    *time.Time
 	ToDate      *time.Time
-	Limit       *int
-	Offset      *int
+	// CreatedSince and UpdatedSince keep subscriptions created or updated at
+	// or after the given time.
+	CreatedSince *time.Time
+	UpdatedSince *time.Time
+	// OrderBy is one of the SortBy* columns, start_date by default.
+	OrderBy string
+	Desc    bool
+	Limit   *int
+	Offset  *int
 }
 
+// Columns subscriptions can be listed by.
+const (
+	SortByStartDate = "start_date"
+	SortByCreatedAt = "created_at"
+	SortByUpdatedAt = "updated_at"
+)
+
 type SummaryFilter struct {
 	UserID      *string
 	ServiceName *string
 	FromDate    time.Time
 	ToDate      *time.Time
 }
+
+// SubscriptionChange is an entry of the change feed: the current state of a
+// subscription or, when Deleted, the fact that it is gone from the feed,
+// deleted or, in a user's feed, handed over to another owner.
+type SubscriptionChange struct {
+	ID           string
+	Deleted      bool
+	Subscription *Subscription `json:",omitempty"`
+	Cursor       ChangeCursor  `json:"-"`
+	// Token resumes the feed right after this change.
+	Token string `json:"-"`
+}
+
+// ChangeCursor is a position in the change feed, which is ordered by the
+// change sequence and then by subscription ID. An empty ID precedes every
+// subscription of the sequence.
+type ChangeCursor struct {
+	Seq int64
+	ID  string
+}
+
+// Before reports whether c comes before o in the change feed.
+func (c ChangeCursor) Before(o ChangeCursor) bool {
+	return c.Seq < o.Seq || (c.Seq == o.Seq && c.ID < o.ID)
+}
+
+type ChangeFilter struct {
+	UserID *string
+	After  ChangeCursor
+	Limit  int
+}
+
+// ChangeFeed is a page of changes. Next resumes after it, even when it is
+// empty; HasMore tells whether the next page can be requested right away.
+type ChangeFeed struct {
+	Changes []*SubscriptionChange
+	Next    string
+	HasMore bool
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/model"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Notifier interface {
+	NotifyRenewal(ctx context.Context, s *model.Subscription, month time.Time) error
+}
+
+// LogNotifier writes notifications to the application log. It is used
+// until a real delivery channel is configured.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) NotifyRenewal(ctx context.Context, s *model.Subscription, month time.Time) error {
+	fields := []zap.Field{
+		zap.String("subscription_id", s.ID),
+		zap.String("tenant_id", s.TenantID),
+		zap.String("user_id", s.UserID),
+		zap.String("service", s.ServiceName),
+		zap.Int("price", s.PriceFor(month)),
+		zap.String("month", month.Format("01-2006")),
+	}
+	if s.TrialEndsOn != nil {
+		fields = append(fields, zap.String("trial_ends_on", s.TrialEndsOn.Format("01-2006")))
+	}
+
+	logger.FromContext(ctx).Info("Renewal reminder", fields...)
+	return nil
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseLimit reads a limit written as "rate:burst", e.g. "2:10" for two
+// requests per second with bursts of ten.
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not in the form rate:burst", s)
+	}
+
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 {
+		return Limit{}, fmt.Errorf("limit %q: rate must be a positive number", s)
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return Limit{}, fmt.Errorf("limit %q: burst must be a positive integer", s)
+	}
+	return Limit{Rate: r, Burst: b}, nil
+}
+
+// Bucket is the state of one client's bucket.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed. It is zero
+	// for allowed requests.
+	RetryAfter time.Duration
+}
+
+// Take refills b up to now and takes a token from it if there is one. A nil
+// b stands for a full bucket. The returned bucket is the new state.
+func Take(b *Bucket, l Limit, now time.Time) (Bucket, Result) {
+	tokens := float64(l.Burst)
+	if b != nil {
+		elapsed := now.Sub(b.Updated).Seconds()
+		tokens = math.Min(float64(l.Burst), b.Tokens+math.Max(elapsed, 0)*l.Rate)
+	}
+
+	var res Result
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+
+	res.Remaining = int(tokens)
+	res.Reset = seconds((float64(l.Burst) - tokens) / l.Rate)
+	return Bucket{Tokens: tokens, Updated: now}, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps the buckets of all clients.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (Result, error)
+}
+
+// sweepInterval is how often MemoryStore drops buckets that have refilled.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets in process memory, so every replica limits on
+// its own.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	Bucket
+	limit Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, l Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	var prev *Bucket
+	if b, ok := s.buckets[key]; ok {
+		prev = &b.Bucket
+	}
+
+	next, res := Take(prev, l, now)
+	s.buckets[key] = &memoryBucket{Bucket: next, limit: l}
+	return res, nil
+}
+
+// sweep forgets buckets that are full by now; they behave exactly like
+// missing ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.Tokens+now.Sub(b.Updated).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
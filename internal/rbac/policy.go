@@ -0,0 +1,184 @@
+package rbac
+
+import (
+	"fmt"
+	"online-subscription/internal/auth"
+	"os"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type Permission string
+
+const (
+	SubscriptionsRead    Permission = "subscriptions:read"
+	SubscriptionsCreate  Permission = "subscriptions:create"
+	SubscriptionsUpdate  Permission = "subscriptions:update"
+	SubscriptionsDelete  Permission = "subscriptions:delete"
+	SubscriptionsSummary Permission = "subscriptions:summary"
+	BudgetsRead          Permission = "budgets:read"
+	BudgetsWrite         Permission = "budgets:write"
+	SettingsRead         Permission = "settings:read"
+	SettingsWrite        Permission = "settings:write"
+	APIKeysRead          Permission = "api_keys:read"
+	APIKeysWrite         Permission = "api_keys:write"
+)
+
+var knownPermissions = map[Permission]bool{
+	SubscriptionsRead:    true,
+	SubscriptionsCreate:  true,
+	SubscriptionsUpdate:  true,
+	SubscriptionsDelete:  true,
+	SubscriptionsSummary: true,
+	BudgetsRead:          true,
+	BudgetsWrite:         true,
+	SettingsRead:         true,
+	SettingsWrite:        true,
+	APIKeysRead:          true,
+	APIKeysWrite:         true,
+}
+
+// Role grants permissions. "*" grants all of them and "subscriptions:*" all
+// permissions on subscriptions. AllUsers lifts the restriction to the
+// caller's own data.
+type Role struct {
+	AllUsers    bool         `yaml:"all_users"`
+	Permissions []Permission `yaml:"permissions"`
+}
+
+// Policy maps the roles of users and the scopes of API keys to permissions.
+// Users whose token carries no role get DefaultRole.
+type Policy struct {
+	DefaultRole string                  `yaml:"default_role"`
+	Roles       map[string]Role         `yaml:"roles"`
+	Scopes      map[string][]Permission `yaml:"scopes"`
+}
+
+// DefaultPolicy is used when no policy file is configured. It keeps the
+// behaviour from before roles were introduced: users manage their own data,
+// admins everybody's, and API keys are limited by their scopes.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		DefaultRole: "user",
+		Roles: map[string]Role{
+			auth.RoleAdmin: {AllUsers: true, Permissions: []Permission{"*"}},
+			"user":         {Permissions: []Permission{"subscriptions:*", "budgets:*"}},
+			"support": {AllUsers: true, Permissions: []Permission{
+				SubscriptionsRead, SubscriptionsSummary, BudgetsRead,
+			}},
+			"analyst": {AllUsers: true, Permissions: []Permission{SubscriptionsSummary, BudgetsRead}},
+		},
+		Scopes: map[string][]Permission{
+			"admin":   {"*"},
+			"write":   {"subscriptions:*", "budgets:*"},
+			"read":    {SubscriptionsRead, SubscriptionsSummary, BudgetsRead},
+			"summary": {SubscriptionsSummary, BudgetsRead},
+		},
+	}
+}
+
+// LoadPolicy reads a YAML policy file. Unknown permissions are rejected so
+// that a typo does not silently take access away.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy %s: %w", path, err)
+	}
+
+	for name, role := range p.Roles {
+		if err := validatePermissions(role.Permissions); err != nil {
+			return nil, fmt.Errorf("role %q: %w", name, err)
+		}
+	}
+	for name, perms := range p.Scopes {
+		if err := validatePermissions(perms); err != nil {
+			return nil, fmt.Errorf("scope %q: %w", name, err)
+		}
+	}
+	if _, ok := p.Roles[p.DefaultRole]; p.DefaultRole != "" && !ok {
+		return nil, fmt.Errorf("default role %q is not defined", p.DefaultRole)
+	}
+
+	return &p, nil
+}
+
+// Allows reports whether any role or scope of the principal grants perm.
+func (p *Policy) Allows(pr *auth.Principal, perm Permission) bool {
+	for _, granted := range p.permissions(pr) {
+		if matches(granted, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllUsers reports whether the principal works with data of every user
+// rather than only their own. Service clients have no user of their own and
+// always do.
+func (p *Policy) AllUsers(pr *auth.Principal) bool {
+	if pr.IsService() {
+		return true
+	}
+	for _, r := range p.roles(pr) {
+		if p.Roles[r].AllUsers {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) permissions(pr *auth.Principal) []Permission {
+	var perms []Permission
+	for _, r := range p.roles(pr) {
+		perms = append(perms, p.Roles[r].Permissions...)
+	}
+	for _, s := range pr.Scopes {
+		perms = append(perms, p.Scopes[s]...)
+	}
+	return perms
+}
+
+func (p *Policy) roles(pr *auth.Principal) []string {
+	if len(pr.Roles) == 0 && !pr.IsService() && p.DefaultRole != "" {
+		return []string{p.DefaultRole}
+	}
+	return pr.Roles
+}
+
+func matches(granted, perm Permission) bool {
+	if granted == "*" || granted == perm {
+		return true
+	}
+	resource, ok := strings.CutSuffix(string(granted), ":*")
+	return ok && strings.HasPrefix(string(perm), resource+":")
+}
+
+func validatePermissions(perms []Permission) error {
+	for _, perm := range perms {
+		if perm == "*" || knownPermissions[perm] {
+			continue
+		}
+		if resource, ok := strings.CutSuffix(string(perm), ":*"); ok && knownResource(resource) {
+			continue
+		}
+		return fmt.Errorf("unknown permission %q", perm)
+	}
+	return nil
+}
+
+// knownResource reports whether some known permission is on resource, so
+// that "resource:*" grants something.
+func knownResource(resource string) bool {
+	for perm := range knownPermissions {
+		if strings.HasPrefix(string(perm), resource+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,30 +1,63 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"online-subscription/internal/logger"
+	"online-subscription/migrations"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
-func RunMigrations(db *sqlx.DB, migrationsPath string) error {
-	driver, err := postgres.WithInstance(db.DB, &postgres.Config{})
+// NewMigrator prepares the migrations at sourceURL, or those embedded in
+// the binary when it is empty, for the schema of db. The migrator works on
+// a connection of its own taken from db; closing it returns only that
+// connection and leaves db open.
+func NewMigrator(db *sqlx.DB, sourceURL string) (*migrate.Migrate, error) {
+	src, err := openSource(sourceURL)
 	if err != nil {
+		return nil, fmt.Errorf("failed to open migrations: %w", err)
+	}
+
+	// postgres.WithInstance would close db along with the migrator.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("failed to get a migration connection: %w", err)
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		src.Close()
+		conn.Close()
 		logger.Error("failed to create migration driver", zap.Error(err))
-		return fmt.Errorf("failed to create migration driver: %w", err)
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
 	}
 
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsPath,
-		"postgres", driver)
+	m, err := migrate.NewWithInstance("migrations", src, "postgres", driver)
+	if err != nil {
+		src.Close()
+		driver.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func RunMigrations(db *sqlx.DB, sourceURL string) error {
+	m, err := NewMigrator(db, sourceURL)
 	if err != nil {
 		return err
 	}
+	defer m.Close()
 
 	err = m.Up()
 	if err != nil && err != migrate.ErrNoChange {
@@ -34,6 +67,33 @@ func RunMigrations(db *sqlx.DB, migrationsPath string) error {
 	return nil
 }
 
+func openSource(sourceURL string) (source.Driver, error) {
+	if sourceURL == "" {
+		return iofs.New(migrations.FS, ".")
+	}
+	return source.Open(sourceURL)
+}
+
+// LatestMigration returns the highest version among the migrations at
+// sourceURL, which is what RunMigrations brings the schema to.
+func LatestMigration(sourceURL string) (uint, error) {
+	versions, err := migrationVersions(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// MigrationVersion reads the version the schema is at and whether the last
+// migration failed halfway. A database never migrated is at version 0.
+func MigrationVersion(ctx context.Context, db *sqlx.DB) (version uint, dirty bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
 func ConnectWithRetry(dsn string, logger *zap.Logger, retries int, delay time.Duration) (*sqlx.DB, error) {
 	var db *sqlx.DB
 	var err error
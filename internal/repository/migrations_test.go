@@ -0,0 +1,21 @@
+package repository_test
+
+import (
+	"online-subscription/internal/repository"
+	"testing"
+)
+
+// TestRunMigrationsKeepsPool checks that the pool migrations run through is
+// still usable once they are done, as the service keeps serving from it.
+func TestRunMigrationsKeepsPool(t *testing.T) {
+	db := testDB(t)
+
+	if err := repository.RunMigrations(db, ""); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	var n int
+	if err := db.Get(&n, `SELECT count(*) FROM subscriptions`); err != nil {
+		t.Fatalf("query after migrations: %v", err)
+	}
+}
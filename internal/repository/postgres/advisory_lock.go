@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AdvisoryLocker elects a single runner across replicas using session-level
+// Postgres advisory locks. The lock lives on a dedicated pool connection,
+// so it is released either by the returned unlock func or when that
+// connection dies.
+type AdvisoryLocker struct {
+	db *sqlx.DB
+}
+
+func NewAdvisoryLocker(db *sqlx.DB) *AdvisoryLocker {
+	return &AdvisoryLocker{db: db}
+}
+
+func (l *AdvisoryLocker) TryLock(ctx context.Context, key int64) (func(), bool, error) {
+	conn, err := l.db.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowxContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		conn.Close()
+	}
+	return unlock, true, nil
+}
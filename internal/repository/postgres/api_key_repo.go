@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"online-subscription/internal/model"
+	"online-subscription/internal/tenant"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// lastUsedResolution limits last_used_at writes to one per key and interval
+// so that busy clients don't turn every request into an UPDATE.
+const lastUsedResolution = "1 minute"
+
+type APIKeyRepo struct {
+	tenantDB
+}
+
+func NewAPIKeyRepo(db *sqlx.DB, rls bool) *APIKeyRepo {
+	return &APIKeyRepo{tenantDB{db: db, rls: rls}}
+}
+
+type apiKeyRow struct {
+	model.APIKey
+	Scopes pq.StringArray `db:"scopes"`
+}
+
+func (row *apiKeyRow) toModel() *model.APIKey {
+	k := row.APIKey
+	k.Scopes = row.Scopes
+	return &k
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, k *model.APIKey) error {
+	query := `
+	INSERT INTO api_keys (id, tenant_id, name, prefix, key_hash, scopes)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING created_at
+	`
+	k.TenantID = tenant.FromContext(ctx)
+
+	return r.run(ctx, func(q sqlx.ExtContext) error {
+		return q.QueryRowxContext(ctx, query,
+			k.ID, k.TenantID, k.Name, k.Prefix, k.KeyHash, pq.Array(k.Scopes),
+		).Scan(&k.CreatedAt)
+	})
+}
+
+// GetByHash looks a key up in all tenants, since the key is what tells
+// which tenant a request belongs to. The row-level security policies would
+// hide the other tenants, so it goes through api_key_by_hash, which runs
+// with the rights of the tables' owner and finds exactly one key.
+func (r *APIKeyRepo) GetByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	var row apiKeyRow
+	err := r.db.GetContext(ctx, &row, `
+	SELECT id, tenant_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at
+	FROM api_key_by_hash($1)
+	`, hash)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return row.toModel(), nil
+}
+
+func (r *APIKeyRepo) List(ctx context.Context) ([]*model.APIKey, error) {
+	var rows []apiKeyRow
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &rows, `
+		SELECT id, tenant_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+		`, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*model.APIKey, 0, len(rows))
+	for i := range rows {
+		keys = append(keys, rows[i].toModel())
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepo) Revoke(ctx context.Context, id string) (bool, error) {
+	var rows int64
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		res, err := q.ExecContext(ctx,
+			`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`,
+			id, tenant.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		rows, _ = res.RowsAffected()
+		return nil
+	})
+	return rows > 0, err
+}
+
+// TouchLastUsed records the use of a key of the tenant in ctx.
+func (r *APIKeyRepo) TouchLastUsed(ctx context.Context, id string) error {
+	return r.run(ctx, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND tenant_id = $2
+		  AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '`+lastUsedResolution+`')
+		`, id, tenant.FromContext(ctx))
+		return err
+	})
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"online-subscription/internal/model"
+	"online-subscription/internal/tenant"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type AuditRepo struct {
+	tenantDB
+}
+
+func NewAuditRepo(db *sqlx.DB, rls bool) *AuditRepo {
+	return &AuditRepo{tenantDB{db: db, rls: rls}}
+}
+
+// Record writes an entry to the log of the entry's tenant.
+func (r *AuditRepo) Record(ctx context.Context, e *model.AuditEntry) error {
+	query := `
+	INSERT INTO audit_log (tenant_id, user_id, api_key_id, roles, action, resource, allowed, reason)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	return r.run(tenant.WithTenant(ctx, e.TenantID), func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, query,
+			e.TenantID, nullString(e.UserID), nullString(e.APIKeyID), pq.Array(e.Roles),
+			e.Action, nullString(e.Resource), e.Allowed, nullString(e.Reason),
+		)
+		return err
+	})
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"online-subscription/internal/metrics"
+	"online-subscription/internal/model"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/tenant"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type BudgetRepo struct {
+	tenantDB
+}
+
+func NewBudgetRepo(db *sqlx.DB, rls bool) *BudgetRepo {
+	return &BudgetRepo{tenantDB{db: db, rls: rls}}
+}
+
+func (r *BudgetRepo) Create(ctx context.Context, b *model.Budget) error {
+	defer metrics.ObserveQuery("budgets", "Create", time.Now())
+
+	query := `
+	INSERT INTO budgets (id, tenant_id, user_id, service_name, period, amount)
+	VALUES (:id, :tenant_id, :user_id, :service_name, :period, :amount)
+	`
+	b.TenantID = tenant.FromContext(ctx)
+
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		_, err := sqlx.NamedExecContext(ctx, q, query, b)
+		return err
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return repository.ErrDuplicate
+	}
+	return err
+}
+
+func (r *BudgetRepo) Get(ctx context.Context, id string) (*model.Budget, error) {
+	defer metrics.ObserveQuery("budgets", "Get", time.Now())
+
+	var b model.Budget
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &b, `
+		SELECT id, tenant_id, user_id, service_name, period, amount
+		FROM budgets
+		WHERE id = $1 AND tenant_id = $2
+		`, id, tenant.FromContext(ctx))
+	})
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *BudgetRepo) Delete(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("budgets", "Delete", time.Now())
+
+	return r.run(ctx, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `DELETE FROM budgets WHERE id=$1 AND tenant_id=$2`, id, tenant.FromContext(ctx))
+		return err
+	})
+}
+
+func (r *BudgetRepo) ListByUser(ctx context.Context, userID string) ([]*model.Budget, error) {
+	defer metrics.ObserveQuery("budgets", "ListByUser", time.Now())
+
+	var budgets []*model.Budget
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &budgets, `
+		SELECT id, tenant_id, user_id, service_name, period, amount
+		FROM budgets
+		WHERE user_id = $1 AND tenant_id = $2
+		ORDER BY period, service_name NULLS FIRST
+		`, userID, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
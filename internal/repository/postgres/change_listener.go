@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"online-subscription/internal/logger"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// changesChannel is notified with the tenant ID by every transaction that
+// writes subscriptions.
+const changesChannel = "subscription_changes"
+
+// notifyChange is run in the writing transaction; PostgreSQL delivers the
+// notification on commit and merges duplicates.
+const notifyChange = `SELECT pg_notify('` + changesChannel + `', $1)`
+
+// listenerPing is how often the listening connection is checked, so that a
+// silently dropped one is noticed and re-established.
+const listenerPing = 90 * time.Second
+
+// ChangeListener wakes up watchers of a tenant when another transaction,
+// possibly on another replica, has written its subscriptions. It keeps a
+// connection of its own and re-establishes it when lost, waking up every
+// watcher because notifications may have been missed in between.
+type ChangeListener struct {
+	listener *pq.Listener
+
+	mu       sync.Mutex
+	watchers map[string]map[chan struct{}]struct{}
+}
+
+// NewChangeListener connects to dsn, logging connection problems to log.
+func NewChangeListener(dsn string, log *zap.Logger) *ChangeListener {
+	l := &ChangeListener{watchers: make(map[string]map[chan struct{}]struct{})}
+	l.listener = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Warn("Change listener connection failed", zap.Error(err))
+		}
+	})
+	return l
+}
+
+// Run dispatches notifications until ctx is done or the listener is closed.
+func (l *ChangeListener) Run(ctx context.Context) {
+	go func() {
+		if err := l.listener.Listen(changesChannel); err != nil {
+			logger.FromContext(ctx).Error("Failed to listen for subscription changes", zap.Error(err))
+		}
+	}()
+
+	ping := time.NewTicker(listenerPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			go l.listener.Ping()
+		case n, ok := <-l.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification follows a reconnect.
+			if n == nil {
+				l.wakeAll()
+			} else {
+				l.wake(n.Extra)
+			}
+		}
+	}
+}
+
+// Watch returns a channel that receives a value after changes in the
+// tenant. Wake-ups are merged while the watcher is busy. stop unregisters
+// the watcher.
+func (l *ChangeListener) Watch(tenantID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	if l.watchers[tenantID] == nil {
+		l.watchers[tenantID] = make(map[chan struct{}]struct{})
+	}
+	l.watchers[tenantID][ch] = struct{}{}
+	l.mu.Unlock()
+
+	return ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.watchers[tenantID], ch)
+		if len(l.watchers[tenantID]) == 0 {
+			delete(l.watchers, tenantID)
+		}
+	}
+}
+
+func (l *ChangeListener) Close() error {
+	return l.listener.Close()
+}
+
+func (l *ChangeListener) wake(tenantID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.watchers[tenantID] {
+		signal(ch)
+	}
+}
+
+func (l *ChangeListener) wakeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, watchers := range l.watchers {
+		for ch := range watchers {
+			signal(ch)
+		}
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"online-subscription/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type MaintenanceRepo struct {
+	db *sqlx.DB
+}
+
+func NewMaintenanceRepo(db *sqlx.DB) *MaintenanceRepo {
+	return &MaintenanceRepo{db: db}
+}
+
+func (r *MaintenanceRepo) ExpireEnded(ctx context.Context, before time.Time) (int64, error) {
+	// Every tenant with expired subscriptions is notified once.
+	query := `
+	WITH expired AS (
+		UPDATE subscriptions
+		SET status = 'expired', updated_at = NOW(), change_seq = ` + changeSeq + `
+		WHERE status = 'active' AND end_date IS NOT NULL AND end_date < $1
+		RETURNING tenant_id
+	), notified AS (
+		SELECT pg_notify('` + changesChannel + `', tenant_id) FROM (SELECT DISTINCT tenant_id FROM expired) t
+	)
+	SELECT (SELECT COUNT(*) FROM expired), (SELECT COUNT(*) FROM notified)
+	`
+	var expired, tenants int64
+	if err := r.db.QueryRowxContext(ctx, query, before).Scan(&expired, &tenants); err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+func (r *MaintenanceRepo) ListRenewals(ctx context.Context, month time.Time) ([]*model.Subscription, error) {
+	var subs []*model.Subscription
+	err := r.db.SelectContext(ctx, &subs, `
+	SELECT s.id, s.tenant_id, s.service_name, s.monthly_price, s.user_id, s.start_date, s.end_date, s.status,
+	       s.trial_ends_on, s.intro_price
+	FROM subscriptions s
+	WHERE s.status = 'active'
+	  AND s.start_date < $1
+	  AND (s.end_date IS NULL OR s.end_date >= $1)
+	  AND NOT EXISTS (
+		SELECT 1 FROM renewal_reminders rr
+		WHERE rr.subscription_id = s.id AND rr.month = $1
+	  )
+	ORDER BY s.tenant_id, s.user_id, s.service_name
+	`, month)
+	if err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *MaintenanceRepo) MarkReminderSent(ctx context.Context, subscriptionID string, month time.Time) error {
+	query := `
+	INSERT INTO renewal_reminders (subscription_id, month, tenant_id)
+	SELECT id, $2, tenant_id FROM subscriptions WHERE id = $1
+	ON CONFLICT (subscription_id, month) DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, subscriptionID, month)
+	return err
+}
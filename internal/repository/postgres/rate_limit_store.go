@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/ratelimit"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	// staleBucketAge is how long an untouched bucket is kept. Any limit
+	// worth configuring refills well within it.
+	staleBucketAge = time.Hour
+	// cleanupInterval is how often stale buckets are deleted.
+	cleanupInterval = 10 * time.Minute
+)
+
+// RateLimitStore shares buckets between replicas through the
+// rate_limit_buckets table. Each Take locks its bucket row, so concurrent
+// requests of one client are counted exactly. Buckets are refilled by the
+// database clock, so replicas whose clocks drift apart still agree.
+type RateLimitStore struct {
+	db          *sqlx.DB
+	lastCleanup atomic.Int64
+}
+
+func NewRateLimitStore(db *sqlx.DB) *RateLimitStore {
+	return &RateLimitStore{db: db}
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Result, error) {
+	s.cleanup(logger.FromContext(ctx))
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	prev, now, err := loadBucket(ctx, tx, key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	next, res := ratelimit.Take(prev, l, now)
+
+	// Two first requests of a client may both miss the row; the upsert makes
+	// the later one win, which at worst lets one extra request through.
+	query := `UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1`
+	if prev == nil {
+		query = `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET tokens = EXCLUDED.tokens, updated_at = EXCLUDED.updated_at
+		`
+	}
+	if _, err := tx.ExecContext(ctx, query, key, next.Tokens, next.Updated); err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return res, tx.Commit()
+}
+
+// loadBucket locks and reads the bucket under key, nil when there is none,
+// and the database time. The time is read after the lock is taken, so a
+// request that waited for it doesn't refill the bucket from an earlier
+// moment.
+func loadBucket(ctx context.Context, tx *sqlx.Tx, key string) (*ratelimit.Bucket, time.Time, error) {
+	var prev *ratelimit.Bucket
+	var b ratelimit.Bucket
+	err := tx.QueryRowxContext(ctx,
+		`SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE`, key,
+	).Scan(&b.Tokens, &b.Updated)
+	switch {
+	case err == nil:
+		prev = &b
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, time.Time{}, err
+	}
+
+	var now time.Time
+	if err := tx.GetContext(ctx, &now, `SELECT clock_timestamp()`); err != nil {
+		return nil, time.Time{}, err
+	}
+	return prev, now, nil
+}
+
+// cleanup deletes buckets nobody used for a while, at most once per
+// cleanupInterval and without delaying the request.
+func (s *RateLimitStore) cleanup(log *zap.Logger) {
+	now := time.Now()
+	last := s.lastCleanup.Load()
+	if now.Sub(time.Unix(0, last)) < cleanupInterval || !s.lastCleanup.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := s.db.ExecContext(ctx,
+			`DELETE FROM rate_limit_buckets WHERE updated_at < now() - make_interval(secs => $1)`,
+			staleBucketAge.Seconds())
+		if err != nil {
+			log.Error("Failed to delete stale rate limit buckets", zap.Error(err))
+		}
+	}()
+}
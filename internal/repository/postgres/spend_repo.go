@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"online-subscription/internal/metrics"
+	"online-subscription/internal/model"
+	"online-subscription/internal/tenant"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// materializeMonths is how far ahead of the current month a rebuild
+	// expands open-ended subscriptions into monthly_spend.
+	materializeMonths = 24
+	// rebuildBatch is how many users Rebuild recomputes per transaction.
+	rebuildBatch = 500
+)
+
+// monthPriceExpr is the amount subscription s is charged for month gs.month:
+// the intro price (free when unset) up to the end of the trial, the regular
+// price afterwards. It mirrors model.Subscription.PriceFor.
+const monthPriceExpr = `CASE
+		WHEN s.trial_ends_on IS NOT NULL AND gs.month <= s.trial_ends_on THEN COALESCE(s.intro_price, 0)
+		ELSE s.monthly_price
+	END`
+
+// notPausedCond drops the months of gs that fall into a pause of s.
+const notPausedCond = `NOT EXISTS (
+		SELECT 1 FROM subscription_pauses p
+		WHERE p.subscription_id = s.id
+		  AND gs.month >= p.start_month
+		  AND (p.end_month IS NULL OR gs.month <= p.end_month)
+	)`
+
+// attributedSpendQuery expands the subscriptions matching cond into one row
+// per paid month up to until, skipping paused months, and splits the price
+// of every month between the owner and the members of the subscription. The
+// amounts of one subscription and month always add up to its price. cond may
+// refer to s and gs.
+//
+// It is the single definition of who pays what and backs both monthly_spend
+// and the live summary. It avoids "::" casts so it can be used in sqlx named
+// queries.
+func attributedSpendQuery(until, cond string) string {
+	return `
+	WITH months AS (
+		SELECT s.id, s.tenant_id, s.user_id, s.service_name, s.monthly_price,
+		       CAST(gs.month AS date) AS month, ` + monthPriceExpr + ` AS price
+		FROM subscriptions s
+		CROSS JOIN LATERAL generate_series(
+			s.start_date,
+			LEAST(COALESCE(s.end_date, ` + until + `), ` + until + `),
+			INTERVAL '1 month'
+		) AS gs(month)
+		WHERE ` + notPausedCond + ` AND ` + cond + `
+	),
+	shares AS (
+		SELECT m.id, m.tenant_id, sm.user_id, m.service_name, m.month,
+		       CASE
+		           WHEN sm.share_percent IS NOT NULL THEN m.price * sm.share_percent / 100
+		           ELSE m.price * sm.share_amount / m.monthly_price
+		       END AS amount
+		FROM months m
+		JOIN subscription_members sm ON sm.subscription_id = m.id
+	)
+	SELECT m.tenant_id, m.user_id, m.service_name, m.month,
+	       m.price - COALESCE((
+		       SELECT SUM(sh.amount) FROM shares sh WHERE sh.id = m.id AND sh.month = m.month
+	       ), 0) AS amount
+	FROM months m
+	UNION ALL
+	SELECT sh.tenant_id, sh.user_id, sh.service_name, sh.month, sh.amount
+	FROM shares sh
+	`
+}
+
+// userParticipatesCond matches subscriptions the users given by param own
+// or share.
+func userParticipatesCond(param string) string {
+	return `(s.user_id = ` + param + ` OR EXISTS (
+			SELECT 1 FROM subscription_members sm
+			WHERE sm.subscription_id = s.id AND sm.user_id = ` + param + `
+		))`
+}
+
+// expandSpendQuery aggregates attributedSpendQuery up to until per tenant,
+// user, service and month, which is exactly the contents of monthly_spend.
+func expandSpendQuery(until, cond, outerCond string) string {
+	return `
+	SELECT a.tenant_id, a.user_id, a.service_name, a.month, CAST(SUM(a.amount) AS int) AS amount
+	FROM (` + attributedSpendQuery(until, cond) + `) a
+	WHERE ` + outerCond + `
+	GROUP BY a.tenant_id, a.user_id, a.service_name, a.month
+	`
+}
+
+// SpendRepo answers summaries within the tenant of the context, while
+// Rebuild and Diff work across all tenants and need a connection that the
+// row-level security policies don't bind.
+type SpendRepo struct {
+	tenantDB
+}
+
+func NewSpendRepo(db *sqlx.DB, rls bool) *SpendRepo {
+	return &SpendRepo{tenantDB{db: db, rls: rls}}
+}
+
+// Horizon is the covered_until of monthly_spend_window, the zero time
+// before the first rebuild has finished.
+func (r *SpendRepo) Horizon(ctx context.Context) (time.Time, error) {
+	var covered sql.NullTime
+	err := r.db.GetContext(ctx, &covered, `SELECT covered_until FROM monthly_spend_window`)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return covered.Time, nil
+}
+
+func (r *SpendRepo) Sum(ctx context.Context, f *model.SummaryFilter) (int, error) {
+	defer metrics.ObserveQuery("spend", "Sum", time.Now())
+
+	query := `
+	SELECT COALESCE(SUM(amount), 0)
+	FROM monthly_spend
+	WHERE tenant_id = :tenant_id AND month >= :from_date AND month <= :to_date
+	`
+
+	args := map[string]interface{}{
+		"tenant_id": tenant.FromContext(ctx),
+		"from_date": f.FromDate,
+		"to_date":   f.ToDate,
+	}
+
+	if f.UserID != nil && *f.UserID != "" {
+		query += " AND user_id = :user_id"
+		args["user_id"] = *f.UserID
+	}
+	if f.ServiceName != nil && *f.ServiceName != "" {
+		query += " AND service_name = :service_name"
+		args["service_name"] = *f.ServiceName
+	}
+
+	var sum int
+	err := r.run(ctx, func(q sqlx.ExtContext) error {
+		bound, bargs, err := q.BindNamed(query, args)
+		if err != nil {
+			return err
+		}
+		return sqlx.GetContext(ctx, q, &sum, bound, bargs...)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+// Rebuild recomputes monthly_spend a batch of users at a time, expanding
+// open-ended subscriptions materializeMonths past the month of now. Each
+// batch locks the table only while its own rows are replaced, so writers
+// wait for one batch rather than the whole rebuild. Writes expand to the
+// new window from the start, and summaries rely on it once every batch is
+// done.
+func (r *SpendRepo) Rebuild(ctx context.Context, now time.Time) error {
+	defer metrics.ObserveQuery("spend", "Rebuild", time.Now())
+
+	until := monthStart(now).AddDate(0, materializeMonths, 0)
+	if _, err := r.db.ExecContext(ctx, `
+	INSERT INTO monthly_spend_window (materialize_until) VALUES ($1)
+	ON CONFLICT (singleton) DO UPDATE
+	    SET materialize_until = EXCLUDED.materialize_until,
+	        covered_until = LEAST(monthly_spend_window.covered_until, EXCLUDED.materialize_until)
+	`, until); err != nil {
+		return err
+	}
+
+	var after spendUser
+	for {
+		users, err := r.spendUsersAfter(ctx, after)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+		if err := r.rebuildUsers(ctx, users, until); err != nil {
+			return err
+		}
+		after = users[len(users)-1]
+	}
+
+	// A later rebuild may have moved the window meanwhile; it sets
+	// covered_until itself when done.
+	_, err := r.db.ExecContext(ctx, `
+	UPDATE monthly_spend_window SET covered_until = $1, rebuilt_at = NOW()
+	WHERE materialize_until = $1
+	`, until)
+	return err
+}
+
+type spendUser struct {
+	TenantID string `db:"tenant_id"`
+	UserID   string `db:"user_id"`
+}
+
+// spendUsersAfter lists the next batch of users who own or share a
+// subscription or still have monthly_spend rows, in key order.
+func (r *SpendRepo) spendUsersAfter(ctx context.Context, after spendUser) ([]spendUser, error) {
+	if after.UserID == "" {
+		after.UserID = uuid.Nil.String()
+	}
+
+	var users []spendUser
+	err := r.db.SelectContext(ctx, &users, `
+	SELECT tenant_id, user_id FROM (
+		SELECT tenant_id, user_id FROM subscriptions
+		UNION
+		SELECT tenant_id, user_id FROM subscription_members
+		UNION
+		SELECT tenant_id, user_id FROM monthly_spend
+	) u
+	WHERE (tenant_id, user_id) > ($1, $2)
+	ORDER BY tenant_id, user_id
+	LIMIT $3
+	`, after.TenantID, after.UserID, rebuildBatch)
+	return users, err
+}
+
+// rebuildUsers replaces the monthly_spend rows of users. The exclusive lock
+// waits for writers that already refreshed rows and makes later ones wait,
+// and the statements after it see every write committed before.
+func (r *SpendRepo) rebuildUsers(ctx context.Context, users []spendUser, until time.Time) error {
+	tenants := make([]string, len(users))
+	ids := make([]string, len(users))
+	for i, u := range users {
+		tenants[i], ids[i] = u.TenantID, u.UserID
+	}
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE monthly_spend IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM monthly_spend WHERE (tenant_id, user_id) IN `+userPairs("$1", "$2"),
+		pq.Array(tenants), pq.Array(ids),
+	); err != nil {
+		return err
+	}
+
+	batch := userPairs("$2", "$3")
+	query := `INSERT INTO monthly_spend (tenant_id, user_id, service_name, month, amount)` + expandSpendQuery(
+		"$1",
+		`((s.tenant_id, s.user_id) IN `+batch+` OR EXISTS (
+			SELECT 1 FROM subscription_members sm
+			WHERE sm.subscription_id = s.id AND (sm.tenant_id, sm.user_id) IN `+batch+`
+		))`,
+		`(a.tenant_id, a.user_id) IN `+batch,
+	)
+	if _, err := tx.ExecContext(ctx, query, until, pq.Array(tenants), pq.Array(ids)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SpendRepo) Diff(ctx context.Context) ([]*model.SpendMismatch, error) {
+	defer metrics.ObserveQuery("spend", "Diff", time.Now())
+
+	query := `
+	WITH live AS (` + expandSpendQuery("$1", "TRUE", "TRUE") + `)
+	SELECT
+		COALESCE(m.tenant_id, l.tenant_id) AS tenant_id,
+		COALESCE(m.user_id, l.user_id) AS user_id,
+		COALESCE(m.service_name, l.service_name) AS service_name,
+		COALESCE(m.month, l.month) AS month,
+		COALESCE(m.amount, 0) AS stored,
+		COALESCE(l.amount, 0) AS live
+	FROM (SELECT * FROM monthly_spend WHERE month <= $1) m
+	FULL OUTER JOIN live l
+		ON l.tenant_id = m.tenant_id AND l.user_id = m.user_id
+		AND l.service_name = m.service_name AND l.month = m.month
+	WHERE COALESCE(m.amount, 0) <> COALESCE(l.amount, 0)
+	ORDER BY 1, 2, 3, 4
+	`
+
+	horizon, err := r.Horizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var diff []*model.SpendMismatch
+	if err := r.db.SelectContext(ctx, &diff, query, horizon); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// refreshSpend recomputes monthly_spend of the given users of a tenant for
+// one service, up to the materialize_until of monthly_spend_window. It runs
+// inside the transaction of the write that changed them, and the users must
+// include the owner and all members of every touched subscription. Before
+// the first rebuild there is no window and only the old rows are removed.
+func refreshSpend(ctx context.Context, tx *sqlx.Tx, tenantID, serviceName string, userIDs []string) error {
+	users := pq.Array(userIDs)
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM monthly_spend
+		WHERE tenant_id = $1 AND service_name = $2 AND user_id = ANY(CAST($3 AS uuid[]))`,
+		tenantID, serviceName, users,
+	); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO monthly_spend (tenant_id, user_id, service_name, month, amount)` + expandSpendQuery(
+		materializeUntil,
+		`s.tenant_id = $1 AND s.service_name = $2 AND `+userParticipatesCond(`ANY(CAST($3 AS uuid[]))`),
+		`a.user_id = ANY(CAST($3 AS uuid[]))`,
+	)
+	_, err := tx.ExecContext(ctx, query, tenantID, serviceName, users)
+	return err
+}
+
+// materializeUntil is the month writes expand open-ended subscriptions to.
+const materializeUntil = `(SELECT materialize_until FROM monthly_spend_window)`
+
+// userPairs is a subquery of the (tenant_id, user_id) pairs zipped from
+// the tenant and user arrays given by the two params.
+func userPairs(tenants, users string) string {
+	return `(SELECT * FROM unnest(CAST(` + tenants + ` AS text[]), CAST(` + users + ` AS uuid[])))`
+}
+
+// spendUsers returns the owner and the members of a subscription.
+func spendUsers(ctx context.Context, tx *sqlx.Tx, subscriptionID, ownerID string) ([]string, error) {
+	var members []string
+	err := tx.SelectContext(ctx, &members,
+		`SELECT user_id FROM subscription_members WHERE subscription_id = $1`,
+		subscriptionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return append(members, ownerID), nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"online-subscription/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StatsRepo reads figures across all tenants for monitoring.
+type StatsRepo struct {
+	db *sqlx.DB
+}
+
+func NewStatsRepo(db *sqlx.DB) *StatsRepo {
+	return &StatsRepo{db: db}
+}
+
+// TenantStats counts active subscriptions that have started by month and
+// sums the materialized spend of month, per tenant.
+func (r *StatsRepo) TenantStats(ctx context.Context, month time.Time) ([]*model.TenantStats, error) {
+	var stats []*model.TenantStats
+	err := r.db.SelectContext(ctx, &stats, `
+	SELECT tenant_id,
+	       COALESCE(a.active_subscriptions, 0) AS active_subscriptions,
+	       COALESCE(m.monthly_spend, 0) AS monthly_spend
+	FROM (
+		SELECT tenant_id, COUNT(*) AS active_subscriptions
+		FROM subscriptions
+		WHERE status = 'active' AND start_date <= $1
+		GROUP BY tenant_id
+	) a
+	FULL OUTER JOIN (
+		SELECT tenant_id, SUM(amount) AS monthly_spend
+		FROM monthly_spend
+		WHERE month = $1
+		GROUP BY tenant_id
+	) m USING (tenant_id)
+	ORDER BY tenant_id
+	`, month)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -1,41 +1,91 @@
 package postgres
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"online-subscription/internal/metrics"
 	"online-subscription/internal/model"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/tenant"
+	"online-subscription/internal/tracing"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
+// changeSeq is the change_seq of rows written by the current transaction.
+const changeSeq = `pg_current_xact_id()::TEXT::BIGINT`
+
+// SubscriptionRepo scopes every query to the tenant in the context. With
+// rls set it additionally tags each transaction with the tenant so that the
+// row-level security policies apply.
 type SubscriptionRepo struct {
-	db *sqlx.DB
+	tenantDB
 }
 
-func NewSubscriptionRepo(db *sqlx.DB) *SubscriptionRepo {
-	return &SubscriptionRepo{db: db}
+func NewSubscriptionRepo(db *sqlx.DB, rls bool) *SubscriptionRepo {
+	return &SubscriptionRepo{tenantDB{db: db, rls: rls}}
 }
 
-func (r *SubscriptionRepo) Create(ctx context.Context, s *model.Subscription) error {
+func (r *SubscriptionRepo) Create(ctx context.Context, s *model.Subscription) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "Create", time.Now())
+
 	query := `
 	INSERT INTO subscriptions (
-		id, service_name, monthly_price, user_id, start_date, end_date
+		id, tenant_id, service_name, monthly_price, user_id, start_date, end_date, status,
+		trial_ends_on, intro_price, change_seq
 	) VALUES (
-		:id, :service_name, :monthly_price, :user_id, :start_date, :end_date
+		:id, :tenant_id, :service_name, :monthly_price, :user_id, :start_date, :end_date, :status,
+		:trial_ends_on, :intro_price, ` + changeSeq + `
 	)
+	RETURNING created_at, updated_at
 	`
-	_, err := r.db.NamedExecContext(ctx, query, s)
-	return err
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Create", query)
+	defer tracing.End(span, &err)
+
+	s.TenantID = tenant.FromContext(ctx)
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := namedScan(ctx, tx, query, s, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, notifyChange, s.TenantID); err != nil {
+		return err
+	}
+	if err := refreshSpend(ctx, tx, s.TenantID, s.ServiceName, []string{s.UserID}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (r *SubscriptionRepo) Get(ctx context.Context, id string) (*model.Subscription, error) {
-	var s model.Subscription
-	err := r.db.GetContext(ctx, &s, `
-	SELECT id, service_name, monthly_price, user_id, start_date, end_date
+func (r *SubscriptionRepo) Get(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscriptions", "Get", time.Now())
+
+	query := `
+	SELECT id, tenant_id, service_name, monthly_price, user_id, start_date, end_date, status,
+	       trial_ends_on, intro_price, created_at, updated_at
 	FROM subscriptions
-	WHERE id = $1
-	`, id)
+	WHERE id = $1 AND tenant_id = $2
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Get", query)
+	defer tracing.End(span, &err)
+
+	var s model.Subscription
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &s, query, id, tenant.FromContext(ctx))
+	})
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -46,38 +96,87 @@ func (r *SubscriptionRepo) Get(ctx context.Context, id string) (*model.Subscript
 	return &s, nil
 }
 
-func (r *SubscriptionRepo) Update(ctx context.Context, s *model.Subscription) error {
+func (r *SubscriptionRepo) Update(ctx context.Context, s *model.Subscription) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "Update", time.Now())
+
 	query := `
 	UPDATE subscriptions
 	SET service_name=:service_name, monthly_price=:monthly_price, user_id=:user_id,
-	    start_date=:start_date, end_date=:end_date
-	WHERE id=:id
+	    start_date=:start_date, end_date=:end_date, status=:status,
+	    trial_ends_on=:trial_ends_on, intro_price=:intro_price, updated_at=NOW(),
+	    change_seq=` + changeSeq + `
+	WHERE id=:id AND tenant_id=:tenant_id
+	RETURNING created_at, updated_at
 	`
-	res, err := r.db.NamedExecContext(ctx, query, s)
-	if err != nil {
-		return err
-	}
+	// A new owner takes the subscription out of the old owner's change
+	// feed, which a tombstone of the old owner records.
+	handOver := `
+	INSERT INTO subscription_tombstones (id, tenant_id, user_id, change_seq, deleted)
+	SELECT id, tenant_id, user_id, ` + changeSeq + `, FALSE
+	FROM subscriptions
+	WHERE id = $1 AND tenant_id = $2 AND user_id <> $3
+	ON CONFLICT (id, user_id) DO UPDATE
+	    SET change_seq = EXCLUDED.change_seq, deleted = FALSE, deleted_at = NOW()
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Update", query)
+	defer tracing.End(span, &err)
 
-	rows, _ := res.RowsAffected()
-	if rows == 0 {
-		return sql.ErrNoRows
-	}
-	return nil
+	s.TenantID = tenant.FromContext(ctx)
+
+	return r.withSpendRefresh(ctx, s.ID, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, handOver, s.ID, s.TenantID, s.UserID); err != nil {
+			return err
+		}
+		if err := namedScan(ctx, tx, query, s, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, notifyChange, s.TenantID)
+		return err
+	})
 }
 
-func (r *SubscriptionRepo) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM subscriptions WHERE id=$1`
-	_, err := r.db.ExecContext(ctx, query, id)
+func (r *SubscriptionRepo) Delete(ctx context.Context, id string) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "Delete", time.Now())
+
+	// The tombstone keeps the deletion in the change feed.
+	query := `
+	WITH deleted AS (
+		DELETE FROM subscriptions WHERE id=$1 AND tenant_id=$2
+		RETURNING id, tenant_id, user_id
+	)
+	INSERT INTO subscription_tombstones (id, tenant_id, user_id, change_seq)
+	SELECT id, tenant_id, user_id, ` + changeSeq + ` FROM deleted
+	ON CONFLICT (id, user_id) DO UPDATE
+	    SET change_seq = EXCLUDED.change_seq, deleted = TRUE, deleted_at = NOW()
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Delete", query)
+	defer tracing.End(span, &err)
+
+	err = r.withSpendRefresh(ctx, id, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, query, id, tenant.FromContext(ctx)); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, notifyChange, tenant.FromContext(ctx))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	return err
 }
 
-func (r *SubscriptionRepo) List(ctx context.Context, f *model.SubscriptionFilter) ([]*model.Subscription, error) {
+func (r *SubscriptionRepo) List(ctx context.Context, f *model.SubscriptionFilter) (_ []*model.Subscription, err error) {
+	defer metrics.ObserveQuery("subscriptions", "List", time.Now())
+
 	query := `
-	SELECT id, service_name, monthly_price, user_id, start_date, end_date
+	SELECT id, tenant_id, service_name, monthly_price, user_id, start_date, end_date, status,
+	       trial_ends_on, intro_price, created_at, updated_at
 	FROM subscriptions
-	WHERE 1=1
+	WHERE tenant_id = :tenant_id
 	`
-	args := map[string]interface{}{}
+	args := map[string]interface{}{
+		"tenant_id": tenant.FromContext(ctx),
+	}
 
 	if f.UserID != nil && *f.UserID != "" {
 		query += " AND user_id = :user_id"
@@ -96,7 +195,31 @@ func (r *SubscriptionRepo) List(ctx context.Context, f *model.SubscriptionFilter
 		args["to_date"] = *f.ToDate
 	}
 
-	query += " ORDER BY start_date DESC"
+	if f.CreatedSince != nil {
+		query += " AND created_at >= :created_since"
+		args["created_since"] = *f.CreatedSince
+	}
+	if f.UpdatedSince != nil {
+		query += " AND updated_at >= :updated_since"
+		args["updated_since"] = *f.UpdatedSince
+	}
+
+	// Only known columns reach the query; id breaks ties so that pages
+	// don't overlap.
+	orderBy, desc := f.OrderBy, f.Desc
+	if orderBy == "" {
+		orderBy, desc = model.SortByStartDate, true
+	}
+	switch orderBy {
+	case model.SortByStartDate, model.SortByCreatedAt, model.SortByUpdatedAt:
+	default:
+		return nil, fmt.Errorf("unknown sort column %q", orderBy)
+	}
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	query += " ORDER BY " + orderBy + dir + ", id" + dir
 
 	if f.Limit != nil {
 		query += " LIMIT :limit"
@@ -107,60 +230,389 @@ func (r *SubscriptionRepo) List(ctx context.Context, f *model.SubscriptionFilter
 		args["offset"] = *f.Offset
 	}
 
-	rows, err := r.db.NamedQueryContext(ctx, query, args)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.List", query)
+	defer tracing.End(span, &err)
 
 	var subs []*model.Subscription
-	for rows.Next() {
-		var s model.Subscription
-		if err := rows.StructScan(&s); err != nil {
-			return nil, err
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		rows, err := sqlx.NamedQueryContext(ctx, q, query, args)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s model.Subscription
+			if err := rows.StructScan(&s); err != nil {
+				return err
+			}
+			subs = append(subs, &s)
 		}
-		subs = append(subs, &s)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return subs, nil
 }
 
-func (r *SubscriptionRepo) Sum(ctx context.Context, f *model.SummaryFilter) (int, error) {
-	query := `
-	SELECT COALESCE(SUM(
-		monthly_price * (
-			(DATE_PART('year', LEAST(COALESCE(end_date, :to_date), :to_date)) - DATE_PART('year', GREATEST(start_date, :from_date))) * 12 +
-			(DATE_PART('month', LEAST(COALESCE(end_date, :to_date), :to_date)) - DATE_PART('month', GREATEST(start_date, :from_date))) + 1
-		)
-	), 0)
+// Changes merges the written and the deleted subscriptions in feed order.
+// The horizon is the oldest transaction still running: everything below it
+// has committed or aborted, so listing only changes below it never skips
+// one that commits later with a smaller sequence. A feed filtered by user
+// covers the subscriptions the user owns, like List, so a subscription
+// handed over to another owner leaves it as deleted; shared subscriptions
+// stay in their owner's feed only.
+func (r *SubscriptionRepo) Changes(ctx context.Context, f *model.ChangeFilter) (_ []*model.SubscriptionChange, horizon int64, err error) {
+	defer metrics.ObserveQuery("subscriptions", "Changes", time.Now())
+
+	cond := `tenant_id = :tenant_id AND change_seq < :horizon
+		AND (change_seq, id) > (:after_seq, :after_id)`
+	args := map[string]interface{}{
+		"tenant_id": tenant.FromContext(ctx),
+		"after_seq": f.After.Seq,
+		"after_id":  f.After.ID,
+		"limit":     f.Limit,
+	}
+	if f.After.ID == "" {
+		args["after_id"] = uuid.Nil.String()
+	}
+	// Without a user every subscription is in the feed, so only deletions
+	// take one out of it.
+	deletedCond := cond + " AND deleted"
+	if f.UserID != nil && *f.UserID != "" {
+		cond += " AND user_id = :user_id"
+		deletedCond = cond
+		args["user_id"] = *f.UserID
+	}
+
+	written := `
+	SELECT id, tenant_id, service_name, monthly_price, user_id, start_date, end_date, status,
+	       trial_ends_on, intro_price, created_at, updated_at, change_seq
 	FROM subscriptions
-	WHERE start_date <= :to_date AND (end_date IS NULL OR end_date >= :from_date)
+	WHERE ` + cond + `
+	ORDER BY change_seq, id
+	LIMIT :limit
+	`
+	deleted := `
+	SELECT id, change_seq
+	FROM subscription_tombstones
+	WHERE ` + deletedCond + `
+	ORDER BY change_seq, id
+	LIMIT :limit
 	`
 
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Changes", written)
+	defer tracing.End(span, &err)
+
+	var subs []struct {
+		model.Subscription
+		ChangeSeq int64 `db:"change_seq"`
+	}
+	var tombstones []struct {
+		ID        string `db:"id"`
+		ChangeSeq int64  `db:"change_seq"`
+	}
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		// Both lists are cut at the same horizon, read once, so that they
+		// agree even when read outside of a transaction.
+		if err := sqlx.GetContext(ctx, q, &horizon,
+			`SELECT pg_snapshot_xmin(pg_current_snapshot())::TEXT::BIGINT`); err != nil {
+			return err
+		}
+		args["horizon"] = horizon
+
+		bound, bargs, err := q.BindNamed(written, args)
+		if err != nil {
+			return err
+		}
+		if err := sqlx.SelectContext(ctx, q, &subs, bound, bargs...); err != nil {
+			return err
+		}
+
+		bound, bargs, err = q.BindNamed(deleted, args)
+		if err != nil {
+			return err
+		}
+		return sqlx.SelectContext(ctx, q, &tombstones, bound, bargs...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	changes := make([]*model.SubscriptionChange, 0, len(subs)+len(tombstones))
+	for i := range subs {
+		changes = append(changes, &model.SubscriptionChange{
+			ID:           subs[i].ID,
+			Subscription: &subs[i].Subscription,
+			Cursor:       model.ChangeCursor{Seq: subs[i].ChangeSeq, ID: subs[i].ID},
+		})
+	}
+	for _, t := range tombstones {
+		changes = append(changes, &model.SubscriptionChange{
+			ID:      t.ID,
+			Deleted: true,
+			Cursor:  model.ChangeCursor{Seq: t.ChangeSeq, ID: t.ID},
+		})
+	}
+	slices.SortFunc(changes, func(a, b *model.SubscriptionChange) int {
+		return cmp.Or(cmp.Compare(a.Cursor.Seq, b.Cursor.Seq), strings.Compare(a.Cursor.ID, b.Cursor.ID))
+	})
+	if len(changes) > f.Limit {
+		changes = changes[:f.Limit]
+	}
+	return changes, horizon, nil
+}
+
+// Sum attributes each subscription month to the users paying for it. With a
+// user filter only that user's share is counted; without one the shares add
+// up to the full price, so every subscription is counted once.
+func (r *SubscriptionRepo) Sum(ctx context.Context, f *model.SummaryFilter) (_ int, err error) {
+	defer metrics.ObserveQuery("subscriptions", "Sum", time.Now())
+
+	cond := `s.tenant_id = :tenant_id AND gs.month >= :from_date
+		AND s.start_date <= :to_date AND (s.end_date IS NULL OR s.end_date >= :from_date)`
+	outerCond := `TRUE`
+
 	args := map[string]interface{}{
+		"tenant_id": tenant.FromContext(ctx),
 		"from_date": f.FromDate,
 		"to_date":   f.ToDate,
 	}
 
 	if f.UserID != nil && *f.UserID != "" {
-		query += " AND user_id = :user_id"
+		cond += " AND " + userParticipatesCond(":user_id")
+		outerCond = "a.user_id = :user_id"
 		args["user_id"] = *f.UserID
 	}
 	if f.ServiceName != nil && *f.ServiceName != "" {
-		query += " AND service_name = :service_name"
+		cond += " AND s.service_name = :service_name"
 		args["service_name"] = *f.ServiceName
 	}
 
-	nstmt, err := r.db.PrepareNamedContext(ctx, query)
-	if err != nil {
-		return 0, err
-	}
-	defer nstmt.Close()
+	query := `
+	SELECT COALESCE(SUM(a.amount), 0)
+	FROM (` + attributedSpendQuery(":to_date", cond) + `) a
+	WHERE ` + outerCond
+
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.Sum", query)
+	defer tracing.End(span, &err)
 
 	var sum int
-	if err := nstmt.GetContext(ctx, &sum, args); err != nil {
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		bound, bargs, err := q.BindNamed(query, args)
+		if err != nil {
+			return err
+		}
+		return sqlx.GetContext(ctx, q, &sum, bound, bargs...)
+	})
+	if err != nil {
 		return 0, err
 	}
 
 	return sum, nil
 }
+
+func (r *SubscriptionRepo) ListPauses(ctx context.Context, subscriptionID string) (_ []*model.Pause, err error) {
+	defer metrics.ObserveQuery("subscriptions", "ListPauses", time.Now())
+
+	query := `
+	SELECT id, tenant_id, subscription_id, start_month, end_month
+	FROM subscription_pauses
+	WHERE subscription_id = $1 AND tenant_id = $2
+	ORDER BY start_month
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.ListPauses", query)
+	defer tracing.End(span, &err)
+
+	var pauses []*model.Pause
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &pauses, query, subscriptionID, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pauses, nil
+}
+
+func (r *SubscriptionRepo) ListMembers(ctx context.Context, subscriptionID string) (_ []*model.Member, err error) {
+	defer metrics.ObserveQuery("subscriptions", "ListMembers", time.Now())
+
+	query := `
+	SELECT subscription_id, tenant_id, user_id, share_percent, share_amount
+	FROM subscription_members
+	WHERE subscription_id = $1 AND tenant_id = $2
+	ORDER BY created_at
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.ListMembers", query)
+	defer tracing.End(span, &err)
+
+	var members []*model.Member
+	err = r.run(ctx, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &members, query, subscriptionID, tenant.FromContext(ctx))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SaveMember adds a member or changes the share of an existing one.
+func (r *SubscriptionRepo) SaveMember(ctx context.Context, m *model.Member) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "SaveMember", time.Now())
+
+	query := `
+	INSERT INTO subscription_members (subscription_id, tenant_id, user_id, share_percent, share_amount)
+	VALUES (:subscription_id, :tenant_id, :user_id, :share_percent, :share_amount)
+	ON CONFLICT (subscription_id, user_id) DO UPDATE
+	SET share_percent = EXCLUDED.share_percent, share_amount = EXCLUDED.share_amount
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.SaveMember", query)
+	defer tracing.End(span, &err)
+
+	m.TenantID = tenant.FromContext(ctx)
+
+	return r.withSpendRefresh(ctx, m.SubscriptionID, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, query, m)
+		return err
+	})
+}
+
+func (r *SubscriptionRepo) DeleteMember(ctx context.Context, subscriptionID, userID string) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "DeleteMember", time.Now())
+
+	query := `DELETE FROM subscription_members WHERE subscription_id = $1 AND user_id = $2 AND tenant_id = $3`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.DeleteMember", query)
+	defer tracing.End(span, &err)
+
+	return r.withSpendRefresh(ctx, subscriptionID, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, subscriptionID, userID, tenant.FromContext(ctx))
+		return err
+	})
+}
+
+// SavePause inserts or updates a pause and refreshes monthly_spend of its
+// subscription in the same transaction. It returns repository.ErrOverlap
+// when another pause of the subscription covers one of its months; the
+// subscription lock keeps concurrent pauses from both passing the check.
+func (r *SubscriptionRepo) SavePause(ctx context.Context, p *model.Pause) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "SavePause", time.Now())
+
+	query := `
+	INSERT INTO subscription_pauses (id, tenant_id, subscription_id, start_month, end_month)
+	VALUES (:id, :tenant_id, :subscription_id, :start_month, :end_month)
+	ON CONFLICT (id) DO UPDATE
+	SET start_month = EXCLUDED.start_month, end_month = EXCLUDED.end_month
+	`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.SavePause", query)
+	defer tracing.End(span, &err)
+
+	p.TenantID = tenant.FromContext(ctx)
+
+	return r.withSpendRefresh(ctx, p.SubscriptionID, func(tx *sqlx.Tx) error {
+		var overlaps bool
+		if err := tx.GetContext(ctx, &overlaps, `
+		SELECT EXISTS (
+			SELECT 1 FROM subscription_pauses
+			WHERE subscription_id = $1 AND tenant_id = $2 AND id <> $3
+			  AND (CAST($5 AS date) IS NULL OR start_month <= $5)
+			  AND (end_month IS NULL OR end_month >= $4)
+		)`, p.SubscriptionID, p.TenantID, p.ID, p.StartMonth, p.EndMonth); err != nil {
+			return err
+		}
+		if overlaps {
+			return repository.ErrOverlap
+		}
+
+		_, err := tx.NamedExecContext(ctx, query, p)
+		return err
+	})
+}
+
+func (r *SubscriptionRepo) DeletePause(ctx context.Context, p *model.Pause) (err error) {
+	defer metrics.ObserveQuery("subscriptions", "DeletePause", time.Now())
+
+	query := `DELETE FROM subscription_pauses WHERE id = $1 AND tenant_id = $2`
+	ctx, span := tracing.StartQuery(ctx, "SubscriptionRepo.DeletePause", query)
+	defer tracing.End(span, &err)
+
+	return r.withSpendRefresh(ctx, p.SubscriptionID, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, query, p.ID, tenant.FromContext(ctx))
+		return err
+	})
+}
+
+// withSpendRefresh runs fn against a locked subscription and refreshes
+// monthly_spend for everyone who paid for it before or after fn. It returns
+// sql.ErrNoRows when the subscription does not exist in the tenant.
+func (r *SubscriptionRepo) withSpendRefresh(ctx context.Context, subscriptionID string, fn func(tx *sqlx.Tx) error) error {
+	tenantID := tenant.FromContext(ctx)
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := loadSpendScope(ctx, tx, tenantID, subscriptionID, true)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	after, err := loadSpendScope(ctx, tx, tenantID, subscriptionID, false)
+	if errors.Is(err, sql.ErrNoRows) {
+		after = before
+	} else if err != nil {
+		return err
+	}
+
+	users := append(before.users, after.users...)
+	if err := refreshSpend(ctx, tx, tenantID, before.serviceName, users); err != nil {
+		return err
+	}
+	if after.serviceName != before.serviceName {
+		if err := refreshSpend(ctx, tx, tenantID, after.serviceName, users); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type spendScope struct {
+	serviceName string
+	users       []string
+}
+
+func loadSpendScope(ctx context.Context, tx *sqlx.Tx, tenantID, subscriptionID string, lock bool) (*spendScope, error) {
+	query := `SELECT user_id, service_name FROM subscriptions WHERE id = $1 AND tenant_id = $2`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var ownerID, serviceName string
+	if err := tx.QueryRowxContext(ctx, query, subscriptionID, tenantID).Scan(&ownerID, &serviceName); err != nil {
+		return nil, err
+	}
+
+	users, err := spendUsers(ctx, tx, subscriptionID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return &spendScope{serviceName: serviceName, users: users}, nil
+}
+
+// namedScan runs a named query returning one row into dest, such as the
+// columns filled in by the database on INSERT ... RETURNING.
+func namedScan(ctx context.Context, tx *sqlx.Tx, query string, arg any, dest ...any) error {
+	bound, args, err := tx.BindNamed(query, arg)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRowxContext(ctx, bound, args...).Scan(dest...)
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"online-subscription/internal/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// tenantDB runs the queries of repositories that work within the tenant of
+// the context. With rls set every transaction carries the tenant in
+// app.tenant_id, without which the row-level security policies let no row
+// through.
+type tenantDB struct {
+	db  *sqlx.DB
+	rls bool
+}
+
+// begin starts a transaction, tagged with the tenant of ctx when row-level
+// security is enforced.
+func (t tenantDB) begin(ctx context.Context) (*sqlx.Tx, error) {
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !t.rls {
+		return tx, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`SELECT set_config('app.tenant_id', $1, true)`, tenant.FromContext(ctx),
+	); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// run executes single statements. Without row-level security they go
+// straight to the pool; with it they need a transaction to carry the
+// tenant.
+func (t tenantDB) run(ctx context.Context, fn func(q sqlx.ExtContext) error) error {
+	if !t.rls {
+		return fn(t.db)
+	}
+
+	tx, err := t.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,7 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"online-subscription/internal/model"
+	"time"
+)
+
+var (
+	ErrDuplicate = errors.New("already exists")
+	ErrOverlap   = errors.New("overlaps an existing period")
 )
 
 type SubscriptionRepository interface {
@@ -12,6 +19,59 @@ type SubscriptionRepository interface {
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context, filter *model.SubscriptionFilter) ([]*model.Subscription, error)
 	Sum(ctx context.Context, filter *model.SummaryFilter) (int, error)
+	ListPauses(ctx context.Context, subscriptionID string) ([]*model.Pause, error)
+	SavePause(ctx context.Context, p *model.Pause) error
+	DeletePause(ctx context.Context, p *model.Pause) error
+	ListMembers(ctx context.Context, subscriptionID string) ([]*model.Member, error)
+	SaveMember(ctx context.Context, m *model.Member) error
+	DeleteMember(ctx context.Context, subscriptionID, userID string) error
+	// Changes lists up to filter.Limit changes after filter.After, all below
+	// the returned horizon, before which the feed no longer changes. A zero
+	// limit only reads the horizon.
+	Changes(ctx context.Context, filter *model.ChangeFilter) ([]*model.SubscriptionChange, int64, error)
+}
+
+// ChangeNotifier tells when the subscriptions of a tenant may have changed.
+// Watch returns a channel receiving a value after such changes and a
+// function that stops watching.
+type ChangeNotifier interface {
+	Watch(tenantID string) (<-chan struct{}, func())
+}
+
+type BudgetRepository interface {
+	Create(ctx context.Context, b *model.Budget) error
+	Get(ctx context.Context, id string) (*model.Budget, error)
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID string) ([]*model.Budget, error)
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, k *model.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]*model.APIKey, error)
+	Revoke(ctx context.Context, id string) (bool, error)
+	TouchLastUsed(ctx context.Context, id string) error
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, e *model.AuditEntry) error
+}
+
+// MaintenanceRepository backs the periodic jobs run by the scheduler.
+type MaintenanceRepository interface {
+	ExpireEnded(ctx context.Context, before time.Time) (int64, error)
+	ListRenewals(ctx context.Context, month time.Time) ([]*model.Subscription, error)
+	MarkReminderSent(ctx context.Context, subscriptionID string, month time.Time) error
+}
+
+// SpendRepository serves summaries from pre-aggregated monthly amounts.
+// Horizon is the last month the aggregates are guaranteed to cover, as of
+// the last completed Rebuild, which expands them relative to now.
+type SpendRepository interface {
+	Sum(ctx context.Context, filter *model.SummaryFilter) (int, error)
+	Horizon(ctx context.Context) (time.Time, error)
+	Rebuild(ctx context.Context, now time.Time) error
+	Diff(ctx context.Context) ([]*model.SpendMismatch, error)
 }
 
 type Scanner interface {
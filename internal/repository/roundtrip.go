@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jmoiron/sqlx"
+)
+
+// schemaQuery lists the objects of the current schema that migrations
+// create, one line each, so that two states of the schema can be compared.
+// Column positions are left out on purpose: re-adding a dropped column puts
+// it last, which changes nothing for the application.
+const schemaQuery = `
+SELECT line FROM (
+    SELECT 'column ' || table_name || '.' || column_name || ' ' || data_type || ' ' || is_nullable
+               || ' ' || COALESCE(column_default, '') AS line
+    FROM information_schema.columns
+    WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+    UNION ALL
+    SELECT 'index ' || indexname || ' ' || indexdef
+    FROM pg_indexes
+    WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'
+    UNION ALL
+    SELECT 'constraint ' || c.conrelid::regclass || '.' || c.conname || ' ' || pg_get_constraintdef(c.oid)
+    FROM pg_constraint c
+    WHERE c.connamespace = to_regnamespace(current_schema()) AND c.conrelid <> 0
+      AND c.conrelid::regclass::text <> 'schema_migrations'
+    UNION ALL
+    SELECT 'row_security ' || relname
+    FROM pg_class
+    WHERE relnamespace = to_regnamespace(current_schema()) AND relrowsecurity
+    UNION ALL
+    SELECT 'policy ' || tablename || '.' || policyname || ' ' || COALESCE(qual, '') || ' ' || COALESCE(with_check, '')
+    FROM pg_policies
+    WHERE schemaname = current_schema()
+    UNION ALL
+    SELECT 'trigger ' || pg_get_triggerdef(t.oid)
+    FROM pg_trigger t
+             JOIN pg_class c ON c.oid = t.tgrelid
+    WHERE c.relnamespace = to_regnamespace(current_schema()) AND NOT t.tgisinternal
+    UNION ALL
+    SELECT 'function ' || p.oid::regprocedure || ' ' || md5(p.prosrc)
+    FROM pg_proc p
+    WHERE p.pronamespace = to_regnamespace(current_schema())
+    UNION ALL
+    SELECT 'sequence ' || sequence_name || ' ' || data_type
+    FROM information_schema.sequences
+    WHERE sequence_schema = current_schema()
+    UNION ALL
+    SELECT 'view ' || table_name || ' ' || view_definition
+    FROM information_schema.views
+    WHERE table_schema = current_schema()
+    UNION ALL
+    SELECT 'type ' || typname || ' ' || typtype
+    FROM pg_type
+    WHERE typnamespace = to_regnamespace(current_schema()) AND typtype IN ('d', 'e')
+) AS objects
+ORDER BY line`
+
+// RoundTrip checks that every migration at sourceURL can be reverted: each
+// one is applied, rolled back and applied again, and the schema must match
+// what it was before and after the first application. Finally everything
+// is rolled back and the schema must be empty again. Down migrations drop
+// data, so RoundTrip refuses databases that have been migrated at all; run
+// it against a disposable one. Progress is written to out.
+func RoundTrip(ctx context.Context, db *sqlx.DB, sourceURL string, out io.Writer) error {
+	m, err := NewMigrator(db, sourceURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if version, _, err := m.Version(); !errors.Is(err, migrate.ErrNilVersion) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("database is at version %d, round trip needs one never migrated", version)
+	}
+
+	versions, err := migrationVersions(sourceURL)
+	if err != nil {
+		return err
+	}
+
+	empty, err := schemaSnapshot(ctx, db)
+	if err != nil {
+		return err
+	}
+	before := empty
+	for _, v := range versions {
+		if err := m.Migrate(v); err != nil {
+			return fmt.Errorf("%d up: %w", v, err)
+		}
+		after, err := schemaSnapshot(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		if err := m.Steps(-1); err != nil {
+			return fmt.Errorf("%d down: %w", v, err)
+		}
+		if err := compareSchema(ctx, db, before); err != nil {
+			return fmt.Errorf("%d down does not restore the schema:\n%w", v, err)
+		}
+
+		if err := m.Migrate(v); err != nil {
+			return fmt.Errorf("%d up after down: %w", v, err)
+		}
+		if err := compareSchema(ctx, db, after); err != nil {
+			return fmt.Errorf("%d up after down differs from the first up:\n%w", v, err)
+		}
+
+		fmt.Fprintf(out, "%d ok\n", v)
+		before = after
+	}
+
+	if err := m.Down(); err != nil {
+		return fmt.Errorf("down to empty: %w", err)
+	}
+	if err := compareSchema(ctx, db, empty); err != nil {
+		return fmt.Errorf("schema is not empty after rolling everything back:\n%w", err)
+	}
+	fmt.Fprintf(out, "%d migrations passed the round trip\n", len(versions))
+	return nil
+}
+
+func migrationVersions(sourceURL string) ([]uint, error) {
+	src, err := openSource(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return nil, err
+	}
+	versions := []uint{version}
+	for {
+		version, err = src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return versions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+}
+
+func schemaSnapshot(ctx context.Context, db *sqlx.DB) ([]string, error) {
+	var lines []string
+	if err := db.SelectContext(ctx, &lines, schemaQuery); err != nil {
+		return nil, fmt.Errorf("read schema: %w", err)
+	}
+	return lines, nil
+}
+
+// compareSchema reports the objects missing from or added to the schema
+// compared to want.
+func compareSchema(ctx context.Context, db *sqlx.DB, want []string) error {
+	got, err := schemaSnapshot(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var diff []string
+	for _, line := range want {
+		if !slices.Contains(got, line) {
+			diff = append(diff, "  - "+line)
+		}
+	}
+	for _, line := range got {
+		if !slices.Contains(want, line) {
+			diff = append(diff, "  + "+line)
+		}
+	}
+	if len(diff) > 0 {
+		return errors.New(strings.Join(diff, "\n"))
+	}
+	return nil
+}
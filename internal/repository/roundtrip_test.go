@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"context"
+	"online-subscription/internal/repository"
+	"strings"
+	"testing"
+)
+
+// TestRoundTrip runs every embedded migration up, down and up again against
+// a fresh database.
+func TestRoundTrip(t *testing.T) {
+	db := testDB(t)
+
+	var out strings.Builder
+	if err := repository.RoundTrip(context.Background(), db, "", &out); err != nil {
+		t.Fatalf("round trip:\n%s%v", out.String(), err)
+	}
+	t.Log("\n" + out.String())
+}
@@ -0,0 +1,43 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header carries the request ID in both directions.
+const Header = "X-Request-ID"
+
+// maxLen bounds IDs taken from clients so they can't bloat the logs.
+const maxLen = 128
+
+type requestIDKey struct{}
+
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether an ID received from a client can be reused: short
+// and made of printable ASCII only.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the ID of the request, or "" outside of requests.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
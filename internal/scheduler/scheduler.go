@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"online-subscription/internal/logger"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// Job is a unit of periodic work. Schedule is a standard five-field cron
+// expression (or a descriptor such as "@daily"); an empty schedule disables
+// the job.
+type Job struct {
+	Name     string
+	Schedule string
+	Run      func(ctx context.Context) error
+}
+
+// Locker provides cross-replica mutual exclusion. TryLock must not block:
+// when another holder owns the key it returns ok == false.
+type Locker interface {
+	TryLock(ctx context.Context, key int64) (unlock func(), ok bool, err error)
+}
+
+type Scheduler struct {
+	cron   *cron.Cron
+	locker Locker
+	log    *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	running atomic.Bool
+}
+
+// New returns a scheduler whose jobs log through log.
+func New(locker Locker, log *zap.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(logger.WithLogger(context.Background(), log))
+	return &Scheduler{
+		cron:   cron.New(),
+		locker: locker,
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (s *Scheduler) Register(job Job) error {
+	if job.Schedule == "" {
+		s.log.Info("Job disabled", zap.String("job", job.Name))
+		return nil
+	}
+
+	if _, err := s.cron.AddFunc(job.Schedule, func() { s.run(job) }); err != nil {
+		return fmt.Errorf("invalid schedule %q for job %s: %w", job.Schedule, job.Name, err)
+	}
+
+	s.log.Info("Job registered",
+		zap.String("job", job.Name),
+		zap.String("schedule", job.Schedule),
+	)
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+	s.running.Store(true)
+}
+
+// Running reports whether the scheduler has been started and not stopped.
+func (s *Scheduler) Running() bool {
+	return s.running.Load()
+}
+
+// Stop prevents new runs and waits for running jobs to return or for ctx
+// to expire, whichever comes first. Running jobs see their context
+// cancelled.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.running.Store(false)
+	done := s.cron.Stop()
+	s.cancel()
+
+	select {
+	case <-done.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) run(job Job) {
+	ctx := logger.NewContext(s.ctx, zap.String("job", job.Name))
+	log := logger.FromContext(ctx)
+
+	unlock, ok, err := s.locker.TryLock(ctx, lockKey(job.Name))
+	if err != nil {
+		log.Error("Failed to acquire job lock", zap.Error(err))
+		return
+	}
+	if !ok {
+		log.Debug("Job is running on another replica, skipping")
+		return
+	}
+	defer unlock()
+
+	started := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Error("Job failed",
+			zap.Duration("duration", time.Since(started)),
+			zap.Error(err),
+		)
+		return
+	}
+
+	log.Info("Job finished", zap.Duration("duration", time.Since(started)))
+}
+
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("online-subscription:job:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,32 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default is the tenant of requests that name none, so single-tenant
+// deployments keep working without any setup.
+const Default = "default"
+
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Valid reports whether id can be used as a tenant ID.
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+type tenantKey struct{}
+
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant of the request, or Default when none was
+// set, e.g. for internal calls.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok && id != "" {
+		return id
+	}
+	return Default
+}
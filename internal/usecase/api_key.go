@@ -0,0 +1,142 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"online-subscription/internal/auth"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/tenant"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const apiKeyPrefix = "osk_"
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid or revoked API key")
+	ErrInvalidScopes  = errors.New("name is required and scopes must be some of read, write, admin, summary")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+var validScopes = map[string]bool{
+	model.ScopeRead:    true,
+	model.ScopeWrite:   true,
+	model.ScopeAdmin:   true,
+	model.ScopeSummary: true,
+}
+
+type APIKeyUseCase struct {
+	repo  repository.APIKeyRepository
+	authz *rbac.Authorizer
+}
+
+func NewAPIKeyUseCase(repo repository.APIKeyRepository, authz *rbac.Authorizer) *APIKeyUseCase {
+	return &APIKeyUseCase{repo: repo, authz: authz}
+}
+
+// Create issues a new key. The plain key is returned only here; afterwards
+// just its hash is known. Internal calls without a principal, such as the
+// create-api-key command used to bootstrap the first key, are allowed.
+func (uc *APIKeyUseCase) Create(ctx context.Context, name string, scopes []string) (*model.APIKey, string, error) {
+	if err := uc.authz.Authorize(ctx, rbac.APIKeysWrite, "api_keys"); err != nil {
+		return nil, "", err
+	}
+	if name == "" || len(scopes) == 0 {
+		return nil, "", ErrInvalidScopes
+	}
+	for _, s := range scopes {
+		if !validScopes[s] {
+			return nil, "", ErrInvalidScopes
+		}
+	}
+
+	prefix, err := randomString(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plain := apiKeyPrefix + prefix + "_" + secret
+
+	k := &model.APIKey{
+		ID:      uuid.New().String(),
+		Name:    name,
+		Prefix:  apiKeyPrefix + prefix,
+		KeyHash: hashAPIKey(plain),
+		Scopes:  scopes,
+	}
+	if err := uc.repo.Create(ctx, k); err != nil {
+		return nil, "", err
+	}
+	return k, plain, nil
+}
+
+func (uc *APIKeyUseCase) List(ctx context.Context) ([]*model.APIKey, error) {
+	if err := uc.authz.Authorize(ctx, rbac.APIKeysRead, "api_keys"); err != nil {
+		return nil, err
+	}
+	return uc.repo.List(ctx)
+}
+
+func (uc *APIKeyUseCase) Revoke(ctx context.Context, id string) error {
+	if err := uc.authz.Authorize(ctx, rbac.APIKeysWrite, "api_key:"+id); err != nil {
+		return err
+	}
+
+	ok, err := uc.repo.Revoke(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// VerifyKey resolves a plain key to the service principal it stands for and
+// records that the key was used.
+func (uc *APIKeyUseCase) VerifyKey(ctx context.Context, key string) (*auth.Principal, error) {
+	k, err := uc.repo.GetByHash(ctx, hashAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if k == nil || k.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// The request has no tenant yet; the key belongs to its own.
+	if err := uc.repo.TouchLastUsed(tenant.WithTenant(ctx, k.TenantID), k.ID); err != nil {
+		logger.FromContext(ctx).Error("Failed to record API key usage", zap.String("id", k.ID), zap.Error(err))
+	}
+
+	p := &auth.Principal{APIKeyID: k.ID, TenantID: k.TenantID, Scopes: k.Scopes}
+	for _, s := range k.Scopes {
+		if s == model.ScopeAdmin {
+			p.Roles = append(p.Roles, auth.RoleAdmin)
+		}
+	}
+	return p, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/repository"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidBudget = errors.New("invalid budget data")
+
+type BudgetUseCase struct {
+	repo  repository.BudgetRepository
+	subs  *SubscriptionUseCase
+	authz *rbac.Authorizer
+	now   func() time.Time
+}
+
+func NewBudgetUseCase(repo repository.BudgetRepository, subs *SubscriptionUseCase, authz *rbac.Authorizer) *BudgetUseCase {
+	return &BudgetUseCase{repo: repo, subs: subs, authz: authz, now: time.Now}
+}
+
+// SetClock replaces time.Now as the moment whose budget periods Evaluate
+// checks.
+func (uc *BudgetUseCase) SetClock(now func() time.Time) {
+	uc.now = now
+}
+
+func (uc *BudgetUseCase) Create(ctx context.Context, b *model.Budget) error {
+	if b.UserID == "" || b.Amount <= 0 {
+		return ErrInvalidBudget
+	}
+	if b.Period != model.BudgetMonthly && b.Period != model.BudgetYearly {
+		return ErrInvalidBudget
+	}
+	if err := uc.authz.AuthorizeUser(ctx, rbac.BudgetsWrite, b.UserID); err != nil {
+		return err
+	}
+
+	b.ID = uuid.New().String()
+
+	return uc.repo.Create(ctx, b)
+}
+
+// Get returns nil for budgets of other users.
+func (uc *BudgetUseCase) Get(ctx context.Context, id string) (*model.Budget, error) {
+	return uc.visible(ctx, rbac.BudgetsRead, id)
+}
+
+func (uc *BudgetUseCase) Delete(ctx context.Context, id string) error {
+	b, err := uc.visible(ctx, rbac.BudgetsWrite, id)
+	if err != nil || b == nil {
+		return err
+	}
+	return uc.repo.Delete(ctx, id)
+}
+
+func (uc *BudgetUseCase) List(ctx context.Context, userID string) ([]*model.Budget, error) {
+	if err := uc.authz.AuthorizeUser(ctx, rbac.BudgetsRead, userID); err != nil {
+		return nil, err
+	}
+	return uc.repo.ListByUser(ctx, userID)
+}
+
+// Status reports spending against every budget of the user for the periods
+// containing at.
+func (uc *BudgetUseCase) Status(ctx context.Context, userID string, at time.Time) ([]*model.BudgetStatus, error) {
+	budgets, err := uc.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*model.BudgetStatus, 0, len(budgets))
+	for _, b := range budgets {
+		st, err := uc.status(ctx, b, at)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// Evaluate checks the budgets a subscription counts against after it has
+// been written. It looks at the period in which the subscription is first
+// charged, but never at one already in the past.
+func (uc *BudgetUseCase) Evaluate(ctx context.Context, s *model.Subscription) ([]model.BudgetWarning, error) {
+	budgets, err := uc.repo.ListByUser(ctx, s.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	at := uc.now()
+	if s.StartDate.After(at) {
+		at = s.StartDate
+	}
+
+	var warnings []model.BudgetWarning
+	for _, b := range budgets {
+		if b.ServiceName != nil && *b.ServiceName != s.ServiceName {
+			continue
+		}
+
+		st, err := uc.status(ctx, b, at)
+		if err != nil {
+			return nil, err
+		}
+		if !st.Exceeded {
+			continue
+		}
+
+		warnings = append(warnings, model.BudgetWarning{
+			BudgetID:    b.ID,
+			ServiceName: b.ServiceName,
+			Period:      b.Period,
+			Amount:      b.Amount,
+			Spent:       st.Spent,
+			Message: fmt.Sprintf("%s budget of %d exceeded: %d spent for %s - %s",
+				b.Period, b.Amount, st.Spent, st.From.Format("01-2006"), st.To.Format("01-2006")),
+		})
+	}
+	return warnings, nil
+}
+
+func (uc *BudgetUseCase) status(ctx context.Context, b *model.Budget, at time.Time) (*model.BudgetStatus, error) {
+	from, to := budgetPeriod(b.Period, at)
+
+	spent, err := uc.subs.sum(ctx, &model.SummaryFilter{
+		UserID:      &b.UserID,
+		ServiceName: b.ServiceName,
+		FromDate:    from,
+		ToDate:      &to,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.BudgetStatus{
+		Budget:    b,
+		From:      from,
+		To:        to,
+		Spent:     spent,
+		Remaining: max(b.Amount-spent, 0),
+		Exceeded:  spent > b.Amount,
+	}, nil
+}
+
+// visible loads a budget after checking perm, or returns nil when it
+// belongs to a user the caller may not see.
+func (uc *BudgetUseCase) visible(ctx context.Context, perm rbac.Permission, id string) (*model.Budget, error) {
+	if err := uc.authz.Authorize(ctx, perm, "budget:"+id); err != nil {
+		return nil, err
+	}
+
+	b, err := uc.repo.Get(ctx, id)
+	if err != nil || b == nil || !uc.authz.CanAccessUser(ctx, b.UserID) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// budgetPeriod returns the first and last month of the budget period
+// containing at.
+func budgetPeriod(period string, at time.Time) (time.Time, time.Time) {
+	month := monthStart(at)
+	if period == model.BudgetYearly {
+		from := time.Date(month.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 11, 0)
+	}
+	return month, month
+}
@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/tenant"
+	"online-subscription/internal/tracing"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MaxChanges is the most changes returned at once; DefaultChanges is used
+// when no limit is given.
+const (
+	DefaultChanges = 100
+	MaxChanges     = 1000
+)
+
+var ErrInvalidChangeToken = errors.New("invalid change token, start over without since")
+
+// Changes returns the subscriptions created, updated or deleted after the
+// position given by token, the Next of a previous feed, or from the
+// beginning when it is empty. Like List it is scoped to the caller unless
+// the caller may read other users' subscriptions.
+func (uc *SubscriptionUseCase) Changes(ctx context.Context, userID *string, token string, limit int) (_ *model.ChangeFeed, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Changes")
+	defer tracing.End(span, &err)
+
+	after, err := decodeChangeToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultChanges
+	}
+	limit = min(limit, MaxChanges)
+
+	userID, err = uc.scopeToCaller(ctx, rbac.SubscriptionsRead, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra change tells whether another page follows.
+	changes, horizon, err := uc.repo.Changes(ctx, &model.ChangeFilter{UserID: userID, After: after, Limit: limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range changes {
+		c.Token = encodeChangeToken(c.Cursor)
+	}
+
+	feed := &model.ChangeFeed{Changes: changes}
+	if len(changes) > limit {
+		feed.Changes = changes[:limit]
+		feed.HasMore = true
+		after = changes[limit-1].Cursor
+	} else if next := (model.ChangeCursor{Seq: horizon}); after.Before(next) {
+		// Everything below the horizon has been seen, so the next request
+		// starts there, skipping the sequences of other users' changes.
+		after = next
+	}
+	feed.Next = encodeChangeToken(after)
+	if feed.Changes == nil {
+		feed.Changes = []*model.SubscriptionChange{}
+	}
+	return feed, nil
+}
+
+// ChangesHead returns the token of the current end of the change feed, so
+// that a client can follow new changes without reading the past ones.
+func (uc *SubscriptionUseCase) ChangesHead(ctx context.Context) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.ChangesHead")
+	defer tracing.End(span, &err)
+
+	if _, err := uc.scopeToCaller(ctx, rbac.SubscriptionsRead, nil); err != nil {
+		return "", err
+	}
+	_, horizon, err := uc.repo.Changes(ctx, &model.ChangeFilter{})
+	if err != nil {
+		return "", err
+	}
+	return encodeChangeToken(model.ChangeCursor{Seq: horizon}), nil
+}
+
+// SetChangeNotifier makes WatchChanges report writes, including those of
+// other replicas.
+func (uc *SubscriptionUseCase) SetChangeNotifier(n repository.ChangeNotifier) {
+	uc.changes = n
+}
+
+// WatchChanges returns a channel receiving a value when the subscriptions
+// of the caller's tenant may have changed, which is when Changes is worth
+// asking again. Without a notifier the channel never receives, and callers
+// are left to poll.
+func (uc *SubscriptionUseCase) WatchChanges(ctx context.Context) (<-chan struct{}, func()) {
+	if uc.changes == nil {
+		return nil, func() {}
+	}
+	return uc.changes.Watch(tenant.FromContext(ctx))
+}
+
+// Change tokens are opaque to clients, which must only pass them back.
+func encodeChangeToken(c model.ChangeCursor) string {
+	s := strconv.FormatInt(c.Seq, 10)
+	if c.ID != "" {
+		s += ":" + c.ID
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeChangeToken(token string) (model.ChangeCursor, error) {
+	if token == "" {
+		return model.ChangeCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return model.ChangeCursor{}, ErrInvalidChangeToken
+	}
+
+	seq, id, hasID := strings.Cut(string(raw), ":")
+	c := model.ChangeCursor{ID: id}
+	if c.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil || c.Seq < 0 {
+		return model.ChangeCursor{}, ErrInvalidChangeToken
+	}
+	if hasID {
+		if _, err := uuid.Parse(id); err != nil {
+			return model.ChangeCursor{}, ErrInvalidChangeToken
+		}
+	}
+	return c, nil
+}
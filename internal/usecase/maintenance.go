@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/model"
+	"online-subscription/internal/notify"
+	"online-subscription/internal/repository"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type MaintenanceUseCase struct {
+	repo     repository.MaintenanceRepository
+	spend    repository.SpendRepository
+	notifier notify.Notifier
+	now      func() time.Time
+}
+
+func NewMaintenanceUseCase(
+	repo repository.MaintenanceRepository,
+	spend repository.SpendRepository,
+	notifier notify.Notifier,
+) *MaintenanceUseCase {
+	return &MaintenanceUseCase{repo: repo, spend: spend, notifier: notifier, now: time.Now}
+}
+
+// SetClock replaces time.Now as the source of the current month.
+func (uc *MaintenanceUseCase) SetClock(now func() time.Time) {
+	uc.now = now
+}
+
+// ExpireEnded marks subscriptions whose last paid month is already behind us.
+func (uc *MaintenanceUseCase) ExpireEnded(ctx context.Context) error {
+	n, err := uc.repo.ExpireEnded(ctx, monthStart(uc.now()))
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("Subscriptions expired", zap.Int64("count", n))
+	return nil
+}
+
+// SendRenewalReminders notifies users about every subscription that will be
+// charged again next month. Each subscription is reminded at most once per
+// month, so reruns are safe.
+func (uc *MaintenanceUseCase) SendRenewalReminders(ctx context.Context) error {
+	month := monthStart(uc.now()).AddDate(0, 1, 0)
+
+	subs, err := uc.repo.ListRenewals(ctx, month)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, s := range subs {
+		if err := uc.notifier.NotifyRenewal(ctx, s, month); err != nil {
+			logger.FromContext(ctx).Error("Failed to send renewal reminder", zap.String("id", s.ID), zap.Error(err))
+			failed++
+			continue
+		}
+		if err := uc.repo.MarkReminderSent(ctx, s.ID, month); err != nil {
+			return err
+		}
+	}
+
+	logger.FromContext(ctx).Info("Renewal reminders sent",
+		zap.Int("count", len(subs)-failed),
+		zap.Int("failed", failed),
+	)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d renewal reminders failed", failed, len(subs))
+	}
+	return nil
+}
+
+// RebuildMonthlySpend recomputes the monthly_spend aggregates from scratch.
+// Writes keep them current; the rebuild moves the window for open-ended
+// subscriptions forward and repairs any drift.
+func (uc *MaintenanceUseCase) RebuildMonthlySpend(ctx context.Context) error {
+	if err := uc.spend.Rebuild(ctx, uc.now()); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("Monthly spend rebuilt")
+	return nil
+}
+
+// CheckMonthlySpend compares the aggregates with the live calculation.
+func (uc *MaintenanceUseCase) CheckMonthlySpend(ctx context.Context) ([]*model.SpendMismatch, error) {
+	return uc.spend.Diff(ctx)
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
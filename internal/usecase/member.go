@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/tracing"
+)
+
+var (
+	ErrInvalidShare  = errors.New("exactly one of share_percent (1-100) and share_amount (> 0) must be set")
+	ErrOwnerAsMember = errors.New("the owner already pays the rest of the subscription and cannot be a member")
+	ErrSharesExceed  = errors.New("member shares exceed the subscription price")
+	ErrNotMember     = errors.New("user is not a member of the subscription")
+)
+
+func (uc *SubscriptionUseCase) ListMembers(ctx context.Context, subscriptionID string) (_ []*model.Member, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.ListMembers")
+	defer tracing.End(span, &err)
+
+	sub, err := uc.Get(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return uc.repo.ListMembers(ctx, subscriptionID)
+}
+
+// SaveMember adds a member to a shared subscription or changes their share.
+func (uc *SubscriptionUseCase) SaveMember(ctx context.Context, m *model.Member) (err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.SaveMember")
+	defer tracing.End(span, &err)
+
+	if (m.SharePercent == nil) == (m.ShareAmount == nil) {
+		return ErrInvalidShare
+	}
+	if m.SharePercent != nil && (*m.SharePercent < 1 || *m.SharePercent > 100) {
+		return ErrInvalidShare
+	}
+	if m.ShareAmount != nil && *m.ShareAmount <= 0 {
+		return ErrInvalidShare
+	}
+
+	sub, err := uc.owned(ctx, rbac.SubscriptionsUpdate, m.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if sub.UserID == m.UserID {
+		return ErrOwnerAsMember
+	}
+
+	members, err := uc.repo.ListMembers(ctx, m.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	shares := []*model.Member{m}
+	for _, other := range members {
+		if other.UserID != m.UserID {
+			shares = append(shares, other)
+		}
+	}
+	if !sharesFit(sub.Price, shares) {
+		return ErrSharesExceed
+	}
+
+	return uc.repo.SaveMember(ctx, m)
+}
+
+func (uc *SubscriptionUseCase) RemoveMember(ctx context.Context, subscriptionID, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.RemoveMember")
+	defer tracing.End(span, &err)
+
+	if _, err := uc.owned(ctx, rbac.SubscriptionsUpdate, subscriptionID); err != nil {
+		return err
+	}
+
+	members, err := uc.repo.ListMembers(ctx, subscriptionID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range members {
+		if m.UserID == userID {
+			return uc.repo.DeleteMember(ctx, subscriptionID, userID)
+		}
+	}
+	return ErrNotMember
+}
+
+// sharesFit reports whether the members' shares leave a non-negative
+// remainder for the owner. Fixed amounts are compared with the regular
+// price; during a trial they shrink proportionally, so that is enough.
+func sharesFit(price int, members []*model.Member) bool {
+	// Both sides are scaled by 100 to keep percents integral.
+	var taken int
+	for _, m := range members {
+		if m.SharePercent != nil {
+			taken += *m.SharePercent * price
+		} else {
+			taken += *m.ShareAmount * 100
+		}
+	}
+	return taken <= price*100
+}
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
+	"online-subscription/internal/repository"
+	"online-subscription/internal/tracing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidPause         = errors.New("pause must lie within the subscription and end after it starts")
+	ErrAlreadyPaused        = errors.New("subscription is already paused in this period")
+	ErrNotPaused            = errors.New("subscription is not paused in this month")
+)
+
+// Pause stops billing of a subscription from the month from through until,
+// or indefinitely when until is nil. A nil from pauses from the current
+// month.
+func (uc *SubscriptionUseCase) Pause(ctx context.Context, id string, from, until *time.Time) (_ *model.Pause, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Pause")
+	defer tracing.End(span, &err)
+
+	sub, err := uc.owned(ctx, rbac.SubscriptionsUpdate, id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := uc.now()
+	if from != nil {
+		start = *from
+	}
+	start = monthStart(start)
+	if start.Before(sub.StartDate) || (sub.EndDate != nil && start.After(*sub.EndDate)) {
+		return nil, ErrInvalidPause
+	}
+	if until != nil && until.Before(start) {
+		return nil, ErrInvalidPause
+	}
+
+	p := &model.Pause{
+		ID:             uuid.New().String(),
+		SubscriptionID: id,
+		StartMonth:     start,
+		EndMonth:       until,
+	}
+	err = uc.repo.SavePause(ctx, p)
+	if errors.Is(err, repository.ErrOverlap) {
+		return nil, ErrAlreadyPaused
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Resume bills the subscription again starting with month at, or with the
+// current month when at is nil. The pause covering that month is cut short,
+// or dropped entirely when it would not have started yet. A nil pause is
+// returned in the latter case.
+func (uc *SubscriptionUseCase) Resume(ctx context.Context, id string, at *time.Time) (_ *model.Pause, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Resume")
+	defer tracing.End(span, &err)
+
+	if _, err := uc.owned(ctx, rbac.SubscriptionsUpdate, id); err != nil {
+		return nil, err
+	}
+
+	pauses, err := uc.repo.ListPauses(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	month := uc.now()
+	if at != nil {
+		month = *at
+	}
+	month = monthStart(month)
+	for _, p := range pauses {
+		if !p.Covers(month) {
+			continue
+		}
+
+		if !month.After(p.StartMonth) {
+			return nil, uc.repo.DeletePause(ctx, p)
+		}
+
+		end := month.AddDate(0, -1, 0)
+		p.EndMonth = &end
+		if err := uc.repo.SavePause(ctx, p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	return nil, ErrNotPaused
+}
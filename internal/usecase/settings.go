@@ -0,0 +1,39 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"online-subscription/internal/logger"
+	"online-subscription/internal/rbac"
+)
+
+var ErrInvalidLogLevel = errors.New("level must be one of DEBUG, INFO, WARN, ERROR")
+
+// SettingsUseCase lets admins inspect and change runtime settings of the
+// service without a restart.
+type SettingsUseCase struct {
+	authz *rbac.Authorizer
+}
+
+func NewSettingsUseCase(authz *rbac.Authorizer) *SettingsUseCase {
+	return &SettingsUseCase{authz: authz}
+}
+
+func (uc *SettingsUseCase) LogLevel(ctx context.Context) (string, error) {
+	if err := uc.authz.Authorize(ctx, rbac.SettingsRead, "log_level"); err != nil {
+		return "", err
+	}
+	return logger.Level(), nil
+}
+
+// SetLogLevel applies until the next restart, or until a reload of the
+// configuration changes log.level.
+func (uc *SettingsUseCase) SetLogLevel(ctx context.Context, level string) error {
+	if err := uc.authz.Authorize(ctx, rbac.SettingsWrite, "log_level"); err != nil {
+		return err
+	}
+	if err := logger.SetLevel(level); err != nil {
+		return ErrInvalidLogLevel
+	}
+	return nil
+}
@@ -3,46 +3,219 @@ package usecase
 import (
 	"context"
 	"errors"
+	"online-subscription/internal/auth"
 	"online-subscription/internal/model"
+	"online-subscription/internal/rbac"
 	"online-subscription/internal/repository"
+	"online-subscription/internal/tracing"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+var ErrForbidden = rbac.ErrForeignUser
+
 type SubscriptionUseCase struct {
-	repo repository.SubscriptionRepository
+	repo  repository.SubscriptionRepository
+	spend repository.SpendRepository
+	authz *rbac.Authorizer
+	now   func() time.Time
+	// changes is optional; without it watchers are never woken up.
+	changes repository.ChangeNotifier
 }
 
-func (uc *SubscriptionUseCase) Create(ctx context.Context, input *model.Subscription) error {
+func (uc *SubscriptionUseCase) Create(ctx context.Context, input *model.Subscription) (err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Create")
+	defer tracing.End(span, &err)
+
 	if input.ServiceName == "" || input.Price <= 0 || input.UserID == "" {
 		return errors.New("invalid input subscription data")
 	}
+	if err := uc.authz.AuthorizeUser(ctx, rbac.SubscriptionsCreate, input.UserID); err != nil {
+		return err
+	}
 
 	input.ID = uuid.New().String()
+	input.Status = statusFor(input, uc.now())
 
 	return uc.repo.Create(ctx, input)
 }
 
-func (uc *SubscriptionUseCase) Get(ctx context.Context, id string) (*model.Subscription, error) {
-	return uc.repo.Get(ctx, id)
+// Get returns nil for subscriptions the caller neither owns nor shares, so
+// their existence is not revealed.
+func (uc *SubscriptionUseCase) Get(ctx context.Context, id string) (_ *model.Subscription, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Get")
+	defer tracing.End(span, &err)
+
+	if err := uc.authz.Authorize(ctx, rbac.SubscriptionsRead, "subscription:"+id); err != nil {
+		return nil, err
+	}
+
+	sub, err := uc.repo.Get(ctx, id)
+	if err != nil || sub == nil {
+		return nil, err
+	}
+	if uc.authz.CanAccessUser(ctx, sub.UserID) {
+		return sub, nil
+	}
+
+	p, _ := auth.FromContext(ctx)
+	members, err := uc.repo.ListMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.UserID == p.UserID {
+			return sub, nil
+		}
+	}
+	return nil, nil
 }
 
-func (uc *SubscriptionUseCase) Update(ctx context.Context, s *model.Subscription) error {
+func (uc *SubscriptionUseCase) Update(ctx context.Context, s *model.Subscription) (err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Update")
+	defer tracing.End(span, &err)
+
+	if _, err := uc.owned(ctx, rbac.SubscriptionsUpdate, s.ID); err != nil {
+		return err
+	}
+	if err := uc.authz.AuthorizeUser(ctx, rbac.SubscriptionsUpdate, s.UserID); err != nil {
+		return err
+	}
+
+	members, err := uc.repo.ListMembers(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		// Handing the subscription to a member would bill them twice.
+		if m.UserID == s.UserID {
+			return ErrOwnerAsMember
+		}
+	}
+	if !sharesFit(s.Price, members) {
+		return ErrSharesExceed
+	}
+
+	s.Status = statusFor(s, uc.now())
 	return uc.repo.Update(ctx, s)
 }
 
-func (uc *SubscriptionUseCase) Delete(ctx context.Context, id string) error {
+// Delete is a no-op for subscriptions that don't exist or belong to someone
+// else, like deleting an already deleted one.
+func (uc *SubscriptionUseCase) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Delete")
+	defer tracing.End(span, &err)
+
+	if _, err := uc.owned(ctx, rbac.SubscriptionsDelete, id); err != nil {
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			return nil
+		}
+		return err
+	}
 	return uc.repo.Delete(ctx, id)
 }
 
-func (uc *SubscriptionUseCase) List(ctx context.Context, f *model.SubscriptionFilter) ([]*model.Subscription, error) {
+func (uc *SubscriptionUseCase) List(ctx context.Context, f *model.SubscriptionFilter) (_ []*model.Subscription, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.List")
+	defer tracing.End(span, &err)
+
+	userID, err := uc.scopeToCaller(ctx, rbac.SubscriptionsRead, f.UserID)
+	if err != nil {
+		return nil, err
+	}
+	f.UserID = userID
+
 	return uc.repo.List(ctx, f)
 }
 
-func (uc *SubscriptionUseCase) Sum(ctx context.Context, f *model.SummaryFilter) (int, error) {
+// Sum answers from the monthly_spend aggregates when the requested period is
+// covered by them and falls back to the live calculation otherwise. An open
+// period ends with the current month.
+func (uc *SubscriptionUseCase) Sum(ctx context.Context, f *model.SummaryFilter) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "SubscriptionUseCase.Sum")
+	defer tracing.End(span, &err)
+
+	userID, err := uc.scopeToCaller(ctx, rbac.SubscriptionsSummary, f.UserID)
+	if err != nil {
+		return 0, err
+	}
+	f.UserID = userID
+
+	return uc.sum(ctx, f)
+}
+
+// sum is Sum without access checks, for callers that already made them.
+func (uc *SubscriptionUseCase) sum(ctx context.Context, f *model.SummaryFilter) (int, error) {
+	if f.ToDate == nil {
+		to := monthStart(uc.now())
+		f.ToDate = &to
+	}
+
+	if uc.spend != nil {
+		horizon, err := uc.spend.Horizon(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if !f.ToDate.After(horizon) {
+			return uc.spend.Sum(ctx, f)
+		}
+	}
 	return uc.repo.Sum(ctx, f)
 }
 
-func NewSubscriptionUseCase(repo repository.SubscriptionRepository) *SubscriptionUseCase {
-	return &SubscriptionUseCase{repo: repo}
+// owned loads a subscription the caller may modify with perm: their own, or
+// any for roles working with all users, service clients and internal calls.
+func (uc *SubscriptionUseCase) owned(ctx context.Context, perm rbac.Permission, id string) (*model.Subscription, error) {
+	if err := uc.authz.Authorize(ctx, perm, "subscription:"+id); err != nil {
+		return nil, err
+	}
+
+	sub, err := uc.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil || !uc.authz.CanAccessUser(ctx, sub.UserID) {
+		return nil, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+// scopeToCaller checks perm and narrows a user filter to the caller unless
+// they may see all users.
+// Asking for another user's data is forbidden rather than silently ignored.
+func (uc *SubscriptionUseCase) scopeToCaller(ctx context.Context, perm rbac.Permission, userID *string) (*string, error) {
+	if err := uc.authz.Authorize(ctx, perm, "subscriptions"); err != nil {
+		return nil, err
+	}
+
+	p, ok := auth.FromContext(ctx)
+	if !ok || uc.authz.AllUsers(ctx) {
+		return userID, nil
+	}
+	if userID != nil && *userID != "" && *userID != p.UserID {
+		return nil, uc.authz.AuthorizeUser(ctx, perm, *userID)
+	}
+	return &p.UserID, nil
+}
+
+// statusFor keeps the status consistent with end_date so that extending an
+// expired subscription reactivates it.
+func statusFor(s *model.Subscription, now time.Time) string {
+	if s.EndDate != nil && s.EndDate.Before(monthStart(now)) {
+		return model.StatusExpired
+	}
+	return model.StatusActive
+}
+
+// NewSubscriptionUseCase builds the usecase. spend may be nil, in which case
+// summaries are always calculated live.
+func NewSubscriptionUseCase(repo repository.SubscriptionRepository, spend repository.SpendRepository, authz *rbac.Authorizer) *SubscriptionUseCase {
+	return &SubscriptionUseCase{repo: repo, spend: spend, authz: authz, now: time.Now}
+}
+
+// SetClock replaces time.Now as the source of the current month, which
+// decides statuses and the end of summaries.
+func (uc *SubscriptionUseCase) SetClock(now func() time.Time) {
+	uc.now = now
 }
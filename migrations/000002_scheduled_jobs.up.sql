@@ -0,0 +1,14 @@
+ALTER TABLE subscriptions
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'expired'));
+
+CREATE INDEX idx_subscriptions_status
+    ON subscriptions (status);
+
+CREATE TABLE renewal_reminders
+(
+    subscription_id UUID        NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    month           DATE        NOT NULL,
+    sent_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (subscription_id, month)
+);
@@ -0,0 +1,25 @@
+CREATE TABLE monthly_spend
+(
+    user_id      UUID NOT NULL,
+    service_name TEXT NOT NULL,
+    month        DATE NOT NULL,
+    amount       INT  NOT NULL,
+    PRIMARY KEY (user_id, service_name, month)
+);
+
+CREATE INDEX idx_monthly_spend_month
+    ON monthly_spend (month);
+
+CREATE INDEX idx_monthly_spend_service_name_month
+    ON monthly_spend (service_name, month);
+
+INSERT INTO monthly_spend (user_id, service_name, month, amount)
+SELECT s.user_id, s.service_name, gs.month::date, SUM(s.monthly_price)::int
+FROM subscriptions s
+CROSS JOIN LATERAL generate_series(
+    s.start_date,
+    LEAST(COALESCE(s.end_date, horizon.month), horizon.month),
+    INTERVAL '1 month'
+) AS gs(month)
+CROSS JOIN (SELECT (DATE_TRUNC('month', NOW()) + INTERVAL '24 months')::date AS month) AS horizon
+GROUP BY s.user_id, s.service_name, gs.month;
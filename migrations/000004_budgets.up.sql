@@ -0,0 +1,15 @@
+CREATE TABLE budgets
+(
+    id           UUID PRIMARY KEY,
+    user_id      UUID        NOT NULL,
+    service_name TEXT,
+    period       TEXT        NOT NULL,
+    amount       INT         NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (period IN ('monthly', 'yearly')),
+    CHECK (amount > 0)
+);
+
+CREATE UNIQUE INDEX idx_budgets_user_scope
+    ON budgets (user_id, period, COALESCE(service_name, ''));
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_subscriptions_trial_ends_on;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_trial_after_start,
+    DROP COLUMN IF EXISTS intro_price,
+    DROP COLUMN IF EXISTS trial_ends_on;
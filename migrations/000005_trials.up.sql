@@ -0,0 +1,8 @@
+ALTER TABLE subscriptions
+    ADD COLUMN trial_ends_on DATE,
+    ADD COLUMN intro_price   INT CHECK (intro_price >= 0),
+    ADD CONSTRAINT subscriptions_trial_after_start
+        CHECK (trial_ends_on IS NULL OR trial_ends_on >= start_date);
+
+CREATE INDEX idx_subscriptions_trial_ends_on
+    ON subscriptions (trial_ends_on);
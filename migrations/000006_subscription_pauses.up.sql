@@ -0,0 +1,12 @@
+CREATE TABLE subscription_pauses
+(
+    id              UUID PRIMARY KEY,
+    subscription_id UUID        NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    start_month     DATE        NOT NULL,
+    end_month       DATE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (end_month IS NULL OR end_month >= start_month)
+);
+
+CREATE INDEX idx_subscription_pauses_subscription_id
+    ON subscription_pauses (subscription_id);
@@ -0,0 +1,12 @@
+CREATE TABLE api_keys
+(
+    id           UUID PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    prefix       TEXT        NOT NULL,
+    key_hash     TEXT        NOT NULL UNIQUE,
+    scopes       TEXT[]      NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    CHECK (scopes <@ ARRAY ['read', 'write', 'admin', 'summary']::TEXT[] AND cardinality(scopes) > 0)
+);
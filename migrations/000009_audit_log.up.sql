@@ -0,0 +1,18 @@
+CREATE TABLE audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    user_id    TEXT,
+    api_key_id UUID,
+    roles      TEXT[]      NOT NULL DEFAULT '{}',
+    action     TEXT        NOT NULL,
+    resource   TEXT,
+    allowed    BOOLEAN     NOT NULL,
+    reason     TEXT
+);
+
+CREATE INDEX idx_audit_log_created_at
+    ON audit_log (created_at);
+
+CREATE INDEX idx_audit_log_denied
+    ON audit_log (created_at) WHERE NOT allowed;
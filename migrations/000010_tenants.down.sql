@@ -0,0 +1,32 @@
+DO
+$$
+    DECLARE
+        t TEXT;
+    BEGIN
+        FOREACH t IN ARRAY ARRAY ['subscriptions', 'subscription_pauses', 'subscription_members',
+            'renewal_reminders', 'monthly_spend', 'budgets', 'api_keys', 'audit_log']
+            LOOP
+                EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+                EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+            END LOOP;
+    END
+$$;
+
+DROP INDEX idx_budgets_user_scope;
+CREATE UNIQUE INDEX idx_budgets_user_scope
+    ON budgets (user_id, period, COALESCE(service_name, ''));
+
+ALTER TABLE monthly_spend
+    DROP CONSTRAINT monthly_spend_pkey,
+    ADD PRIMARY KEY (user_id, service_name, month);
+
+DROP INDEX idx_subscriptions_tenant_id_user_id;
+
+ALTER TABLE audit_log DROP COLUMN tenant_id;
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE budgets DROP COLUMN tenant_id;
+ALTER TABLE monthly_spend DROP COLUMN tenant_id;
+ALTER TABLE renewal_reminders DROP COLUMN tenant_id;
+ALTER TABLE subscription_members DROP COLUMN tenant_id;
+ALTER TABLE subscription_pauses DROP COLUMN tenant_id;
+ALTER TABLE subscriptions DROP COLUMN tenant_id;
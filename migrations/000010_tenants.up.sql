@@ -0,0 +1,49 @@
+ALTER TABLE subscriptions
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE subscription_pauses
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE subscription_members
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE renewal_reminders
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE monthly_spend
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE budgets
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE audit_log
+    ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX idx_subscriptions_tenant_id_user_id
+    ON subscriptions (tenant_id, user_id);
+
+ALTER TABLE monthly_spend
+    DROP CONSTRAINT monthly_spend_pkey,
+    ADD PRIMARY KEY (tenant_id, user_id, service_name, month);
+
+DROP INDEX idx_budgets_user_scope;
+CREATE UNIQUE INDEX idx_budgets_user_scope
+    ON budgets (tenant_id, user_id, period, COALESCE(service_name, ''));
+
+-- Row-level security is a second line of defence behind the tenant_id
+-- conditions of the queries. It only applies to roles that don't own the
+-- tables, and only when the application sets app.tenant_id (TENANT_RLS).
+-- Sessions without it, such as background jobs, see every tenant.
+DO
+$$
+    DECLARE
+        t TEXT;
+    BEGIN
+        FOREACH t IN ARRAY ARRAY ['subscriptions', 'subscription_pauses', 'subscription_members',
+            'renewal_reminders', 'monthly_spend', 'budgets', 'api_keys', 'audit_log']
+            LOOP
+                EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+                EXECUTE format(
+                        'CREATE POLICY tenant_isolation ON %I USING ('
+                            'COALESCE(current_setting(''app.tenant_id'', true), '''') = '''' '
+                            'OR tenant_id = current_setting(''app.tenant_id'', true))',
+                        t);
+            END LOOP;
+    END
+$$;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subscriptions_tenant_id_created_at;
+
+DROP INDEX IF EXISTS idx_subscriptions_tenant_id_updated_at;
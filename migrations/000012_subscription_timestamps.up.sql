@@ -0,0 +1,7 @@
+-- Incremental sync lists the subscriptions of a tenant changed since the
+-- last pull, ordered by the change time.
+CREATE INDEX idx_subscriptions_tenant_id_updated_at
+    ON subscriptions (tenant_id, updated_at, id);
+
+CREATE INDEX idx_subscriptions_tenant_id_created_at
+    ON subscriptions (tenant_id, created_at, id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS subscription_tombstones;
+
+DROP INDEX IF EXISTS idx_subscriptions_tenant_id_change_seq;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS change_seq;
@@ -0,0 +1,28 @@
+-- change_seq is the ID of the transaction that last wrote the row. Unlike a
+-- sequence it tells the change feed which changes are final: every
+-- transaction below the oldest one still running has committed or aborted,
+-- so no change can appear there anymore. The repository sets it on every
+-- write; the default covers rows written elsewhere.
+ALTER TABLE subscriptions
+    ADD COLUMN change_seq BIGINT NOT NULL DEFAULT (pg_current_xact_id()::TEXT::BIGINT);
+
+CREATE INDEX idx_subscriptions_tenant_id_change_seq
+    ON subscriptions (tenant_id, change_seq, id);
+
+-- Deleted subscriptions stay in the change feed as tombstones.
+CREATE TABLE subscription_tombstones
+(
+    id         UUID PRIMARY KEY,
+    tenant_id  TEXT        NOT NULL,
+    user_id    UUID        NOT NULL,
+    change_seq BIGINT      NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_subscription_tombstones_tenant_id_change_seq
+    ON subscription_tombstones (tenant_id, change_seq, id);
+
+ALTER TABLE subscription_tombstones ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON subscription_tombstones USING (
+    COALESCE(current_setting('app.tenant_id', true), '') = ''
+        OR tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,19 @@
+DROP FUNCTION IF EXISTS api_key_by_hash(TEXT);
+
+DO
+$$
+    DECLARE
+        t TEXT;
+    BEGIN
+        FOREACH t IN ARRAY ARRAY ['subscriptions', 'subscription_pauses', 'subscription_members',
+            'renewal_reminders', 'monthly_spend', 'budgets', 'api_keys', 'audit_log', 'subscription_tombstones']
+            LOOP
+                EXECUTE format('DROP POLICY tenant_isolation ON %I', t);
+                EXECUTE format(
+                        'CREATE POLICY tenant_isolation ON %I USING ('
+                            'COALESCE(current_setting(''app.tenant_id'', true), '''') = '''' '
+                            'OR tenant_id = current_setting(''app.tenant_id'', true))',
+                        t);
+            END LOOP;
+    END
+$$;
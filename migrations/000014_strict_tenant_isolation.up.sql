@@ -0,0 +1,35 @@
+-- Sessions that don't set app.tenant_id no longer see every tenant: the
+-- policies now let no row through without it. Work across tenants, such as
+-- background jobs, belongs to a role that owns the tables or has BYPASSRLS.
+DO
+$$
+    DECLARE
+        t TEXT;
+    BEGIN
+        FOREACH t IN ARRAY ARRAY ['subscriptions', 'subscription_pauses', 'subscription_members',
+            'renewal_reminders', 'monthly_spend', 'budgets', 'api_keys', 'audit_log', 'subscription_tombstones']
+            LOOP
+                EXECUTE format('DROP POLICY tenant_isolation ON %I', t);
+                EXECUTE format(
+                        'CREATE POLICY tenant_isolation ON %I USING ('
+                            'tenant_id = current_setting(''app.tenant_id'', true))',
+                        t);
+            END LOOP;
+    END
+$$;
+
+-- An API key is what tells the tenant of a request, so it has to be found
+-- before any tenant is set. The function runs with the rights of its owner,
+-- which owns api_keys, and only ever returns the key with the given hash.
+CREATE FUNCTION api_key_by_hash(p_key_hash TEXT)
+    RETURNS SETOF api_keys
+    LANGUAGE sql
+    STABLE
+    SECURITY DEFINER
+    SET search_path FROM CURRENT
+AS
+$$
+SELECT *
+FROM api_keys
+WHERE key_hash = p_key_hash
+$$;
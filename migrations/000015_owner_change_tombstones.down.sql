@@ -0,0 +1,10 @@
+DELETE FROM subscription_tombstones WHERE NOT deleted;
+
+ALTER TABLE subscription_tombstones
+    DROP CONSTRAINT subscription_tombstones_pkey;
+
+ALTER TABLE subscription_tombstones
+    ADD PRIMARY KEY (id);
+
+ALTER TABLE subscription_tombstones
+    DROP COLUMN IF EXISTS deleted;
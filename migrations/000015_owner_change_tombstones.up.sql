@@ -0,0 +1,12 @@
+-- A tombstone marks a subscription gone from its user's change feed: deleted
+-- or, with deleted false, handed over to another owner. The old owner may
+-- lose the same subscription again after getting it back, so tombstones are
+-- kept per user.
+ALTER TABLE subscription_tombstones
+    ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE subscription_tombstones
+    DROP CONSTRAINT subscription_tombstones_pkey;
+
+ALTER TABLE subscription_tombstones
+    ADD PRIMARY KEY (id, user_id);
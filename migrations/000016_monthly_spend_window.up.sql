@@ -0,0 +1,12 @@
+-- The months monthly_spend holds for open-ended subscriptions. Writes expand
+-- them up to materialize_until; covered_until is set once a rebuild has
+-- expanded every subscription that far, and summaries only trust the
+-- aggregates up to it. Without a row nothing is trusted until the first
+-- rebuild.
+CREATE TABLE monthly_spend_window
+(
+    singleton         BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    materialize_until DATE        NOT NULL,
+    covered_until     DATE,
+    rebuilt_at        TIMESTAMPTZ
+);
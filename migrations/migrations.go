@@ -0,0 +1,8 @@
+// Package migrations embeds the schema migrations into the binary, so that
+// it carries the schema it expects wherever it runs.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS